@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		command string
+		want    []string
+	}{
+		{"echo hello world", []string{"echo", "hello", "world"}},
+		{`  backup  --to '/mnt/my backups'  `, []string{"backup", "--to", "/mnt/my backups"}},
+		{`printf "%s \"quoted\" \$HOME \n"`, []string{"printf", `%s "quoted" $HOME \n`}},
+		{`grep a\ b 'it''s' ""`, []string{"grep", "a b", "its", ""}},
+		{"ls -l \\\n  /tmp", []string{"ls", "-l", "/tmp"}},
+		{"", nil},
+	} {
+		got, err := SplitArgs(tc.command)
+		if err != nil {
+			t.Errorf("SplitArgs(%q) failed: %v", tc.command, err)
+			continue
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tc.command, got, tc.want)
+		}
+	}
+
+	for _, command := range []string{`echo 'oops`, `echo "oops`, `echo oops\`} {
+		if _, err := SplitArgs(command); err == nil {
+			t.Errorf("expected %q to be rejected", command)
+		}
+	}
+}
@@ -1,55 +1,241 @@
 package engine
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/joho/godotenv"
 	"github.com/opencron/opencron/internal/models"
 	"github.com/opencron/opencron/internal/store"
 	"github.com/robfig/cron/v3"
 )
 
+// ErrMaxInstances is returned when a task already has MaxInstances runs in
+// progress.
+var ErrMaxInstances = errors.New("maximum concurrent instances reached")
+
+// ErrRunConditionNotMet is returned when a task's RunCondition does not hold
+// for the outcome of its previous run. The skip is recorded as a run.
+var ErrRunConditionNotMet = errors.New("run condition not met")
+
+// ErrNotStartable is returned when a task may not start now: it is snoozed,
+// its StartAfter has not come yet, or it is inside one of its skip windows.
+// Nothing is recorded.
+var ErrNotStartable = errors.New("task may not start now")
+
+// errNiceUnsupported is returned by startNiced where niceness can't be set.
+var errNiceUnsupported = errors.New("nice is not supported on this platform")
+
 type Engine struct {
-	cron         *cron.Cron
-	store        *store.Store
-	entries      map[int]cron.EntryID
-	mu           sync.Mutex
-	dataDir      string
+	cron  *cron.Cron
+	store *store.Store
+	// entries holds the cron entries of each scheduled task, one per
+	// schedule expression.
+	entries map[int][]cron.EntryID
+	mu      sync.Mutex
+	// lastReload and reloadCount are guarded by mu.
+	lastReload  time.Time
+	reloadCount int
+	runningMu   sync.Mutex
+	running     map[int]int
+	// activeRuns holds the runs currently executing, guarded by runningMu.
+	activeRuns map[*models.Run]string
+	// lastAlert records when each task last sent a notification, for
+	// AlertCooldownMinutes.
+	alertMu   sync.Mutex
+	lastAlert map[int]time.Time
+	// globalEnv holds the variables loaded from GlobalEnvFile.
+	globalEnvMu sync.RWMutex
+	globalEnv   map[string]string
+	// lastHeartbeat holds UnixNano of the latest heartbeat.
+	lastHeartbeat    atomic.Int64
+	heartbeatEnabled atomic.Bool
+	maintenance      atomic.Bool
+	watchdogRestarts atomic.Int64
+	dataDir          string
+	// location is the time zone for schedules without a CRON_TZ= prefix.
+	location     *time.Location
 	LogRetention time.Duration
+	// LogRotation is one of the LogRotation* modes; empty means daily.
+	LogRotation string
+	// LogMarkers is the models.LogMarkers* format for tasks that don't set
+	// their own; empty means text.
+	LogMarkers string
+	// LogArchive, when set, receives each expired log file before it is
+	// deleted. A file that fails to upload is kept and retried next time.
+	LogArchive *S3Archive
+	// DefaultTimeout bounds how long a run may take before its command is
+	// killed. Zero disables the limit. A task's TimeoutSeconds overrides it.
+	DefaultTimeout time.Duration
+	// CommandWrapper, when set, is executed with the task's command as
+	// {{.Command}} to produce the command line that is actually run.
+	CommandWrapper *template.Template
+	// FolderDefaults maps folder paths to settings for the tasks within
+	// them, nested folders included, that don't set their own.
+	FolderDefaults map[string]TaskDefaults
+	// RemoteScriptHosts are the hosts (with port, if not the default) that
+	// commands given as a script URL may be fetched from.
+	RemoteScriptHosts []string
+	// SandboxRuntime is the container runtime sandboxed tasks run in; empty
+	// uses docker or, failing that, podman from PATH.
+	SandboxRuntime string
+	// SandboxImage is the image for sandboxed tasks without their own.
+	SandboxImage string
+	// GlobalEnvFile is a dotenv file whose variables every task's commands
+	// get, below the task's own env_file. See LoadGlobalEnv.
+	GlobalEnvFile string
+	// Environment names this deployment (OPENCRON_ENV). Tasks listing
+	// Environments are only scheduled when it is one of them.
+	Environment string
+	// RunDedupWindow is how long RunTaskDedup remembers a dedup key; zero
+	// means DefaultRunDedupWindow.
+	RunDedupWindow time.Duration
+	// dedup holds recent manual runs by dedup key.
+	dedup runDedup
+	// executors maps command schemes to in-process executors; see
+	// RegisterExecutor.
+	executorsMu sync.RWMutex
+	executors   map[string]Executor
 }
 
 func New(s *store.Store, dataDir string, retention time.Duration) *Engine {
-	return &Engine{
-		cron:         cron.New(),
+	e := &Engine{
+		cron:         cron.New(cron.WithParser(cronParser)),
 		store:        s,
-		entries:      make(map[int]cron.EntryID),
+		entries:      make(map[int][]cron.EntryID),
+		running:      make(map[int]int),
+		activeRuns:   make(map[*models.Run]string),
+		lastAlert:    make(map[int]time.Time),
 		dataDir:      dataDir,
+		location:     time.Local,
 		LogRetention: retention,
 	}
+	e.executors = map[string]Executor{BuiltinScheme: builtinExecutor{e}}
+	return e
 }
 
 func (e *Engine) Start() {
+	if value, err := e.store.GetSetting(maintenanceSetting); err != nil {
+		log.Printf("Failed to load maintenance mode: %v", err)
+	} else if value == "on" {
+		e.maintenance.Store(true)
+		log.Printf("Maintenance mode is on; the API is read-only")
+	}
 	e.cron.Start()
 	e.Reload()
+	e.catchUpMissedRuns(e.Now())
 	e.StartLogJanitor()
 }
 
+// SetLocation sets the time zone that schedules without a CRON_TZ= prefix
+// are evaluated in, instead of the server's local time. It must be called
+// before Start.
+func (e *Engine) SetLocation(loc *time.Location) {
+	e.location = loc
+	e.cron = cron.New(cron.WithParser(cronParser), cron.WithLocation(loc))
+}
+
+// Now returns the current time in the engine's time zone.
+func (e *Engine) Now() time.Time {
+	return time.Now().In(e.location)
+}
+
+// maintenanceSetting is the settings key persisting maintenance mode.
+const maintenanceSetting = "maintenance"
+
+// Maintenance reports whether maintenance mode is on. The engine keeps
+// running scheduled tasks either way; the API uses it to refuse changes.
+func (e *Engine) Maintenance() bool {
+	return e.maintenance.Load()
+}
+
+// SetMaintenance turns maintenance mode on or off and persists it so it
+// survives a restart.
+func (e *Engine) SetMaintenance(on bool) error {
+	value := "off"
+	if on {
+		value = "on"
+	}
+	if err := e.store.SetSetting(maintenanceSetting, value); err != nil {
+		return err
+	}
+	e.maintenance.Store(on)
+	log.Printf("Maintenance mode %s", value)
+	return nil
+}
+
+// catchUpMissedRuns starts one run of each task with the run_once policy
+// whose schedule fired while the server was down.
+func (e *Engine) catchUpMissedRuns(now time.Time) {
+	tasks, err := e.store.GetTasks()
+	if err != nil {
+		log.Printf("Failed to load tasks for missed runs: %v", err)
+		return
+	}
+	for _, t := range tasks {
+		if t.MissedRunPolicy != models.MissedRunRunOnce || !t.Enabled || !e.inEnvironment(t) || !missedRun(t, now) {
+			continue
+		}
+		// A catch-up is gated like the fire it replaces.
+		if err := e.checkStartable(t, now); err != nil {
+			log.Printf("Not catching up missed run: %v", err)
+			continue
+		}
+		log.Printf("Task %s missed a scheduled run, running it once now", t.Name)
+		go func(t models.Task) {
+			if _, err := e.runTask(t); err != nil {
+				log.Printf("Task %s failed: %v", t.Name, err)
+			}
+		}(t)
+	}
+}
+
+// missedRun reports whether the task's schedule fired between its last run
+// (or creation, if it never ran) and now.
+func missedRun(t models.Task, now time.Time) bool {
+	sched, err := TaskSchedule(t)
+	if err != nil {
+		return false
+	}
+	since := t.LastRun
+	if since.IsZero() {
+		since = t.CreatedAt
+	}
+	since = since.In(now.Location())
+	next := sched.Next(since)
+	return !next.IsZero() && !next.After(now)
+}
+
 func (e *Engine) StartLogJanitor() {
-	// Run log cleanup every hour
-	_, _ = e.cron.AddFunc("@hourly", func() {
-		e.PurgeOldLogs()
-	})
+	e.scheduleLogJanitor(e.cron)
 	// Run once at start
 	go e.PurgeOldLogs()
 }
 
+// scheduleLogJanitor adds the hourly log cleanup job to c.
+func (e *Engine) scheduleLogJanitor(c *cron.Cron) {
+	_, _ = c.AddFunc("@hourly", func() {
+		e.PurgeOldLogs()
+	})
+}
+
 func (e *Engine) PurgeOldLogs() {
 	logsDir := filepath.Join(e.dataDir, "logs")
 	entries, err := os.ReadDir(logsDir)
@@ -73,7 +259,14 @@ func (e *Engine) PurgeOldLogs() {
 		}
 
 		if info.ModTime().Before(cutoff) {
-			if err := os.Remove(filepath.Join(logsDir, entry.Name())); err == nil {
+			path := filepath.Join(logsDir, entry.Name())
+			if e.LogArchive != nil {
+				if err := e.LogArchive.Upload(entry.Name(), path); err != nil {
+					log.Printf("Failed to archive log file %s, keeping it: %v", entry.Name(), err)
+					continue
+				}
+			}
+			if err := os.Remove(path); err == nil {
 				purgedCount++
 			}
 		}
@@ -88,11 +281,16 @@ func (e *Engine) Reload() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.lastReload = time.Now()
+	e.reloadCount++
+
 	// Clear existing jobs
-	for _, entryID := range e.entries {
-		e.cron.Remove(entryID)
+	for _, entryIDs := range e.entries {
+		for _, entryID := range entryIDs {
+			e.cron.Remove(entryID)
+		}
 	}
-	e.entries = make(map[int]cron.EntryID)
+	e.entries = make(map[int][]cron.EntryID)
 
 	tasks, err := e.store.GetTasks()
 	if err != nil {
@@ -101,95 +299,1046 @@ func (e *Engine) Reload() {
 	}
 
 	for _, t := range tasks {
-		if t.Enabled {
-			e.addTask(t)
+		ok, scheduleErr := true, ""
+		if t.Enabled && e.inEnvironment(t) {
+			if err := e.addTask(t); err != nil {
+				ok, scheduleErr = false, err.Error()
+			}
+		}
+		if ok != t.LastScheduleOK || scheduleErr != t.ScheduleError {
+			if err := e.store.SetScheduleStatus(t.ID, ok, scheduleErr); err != nil {
+				log.Printf("Failed to record schedule status for task %s (%d): %v", t.Name, t.ID, err)
+			}
 		}
 	}
 }
 
-func (e *Engine) addTask(t models.Task) {
-	entryID, err := e.cron.AddFunc(t.Schedule, func() {
+// SchedulerStatus reports when the scheduler last reloaded its tasks and what
+// it has scheduled.
+type SchedulerStatus struct {
+	LastReload     time.Time `json:"last_reload"`
+	ReloadCount    int       `json:"reload_count"`
+	ScheduledTasks int       `json:"scheduled_tasks"`
+	Maintenance    bool      `json:"maintenance"`
+	// WatchdogRestarts counts how often the watchdog found the scheduler
+	// wedged and replaced it.
+	WatchdogRestarts int `json:"watchdog_restarts"`
+}
+
+// Status returns the scheduler's current status.
+func (e *Engine) Status() SchedulerStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return SchedulerStatus{
+		LastReload:       e.lastReload,
+		ReloadCount:      e.reloadCount,
+		ScheduledTasks:   len(e.entries),
+		Maintenance:      e.Maintenance(),
+		WatchdogRestarts: int(e.watchdogRestarts.Load()),
+	}
+}
+
+// TickedTask is a scheduled task started early by FireDue.
+type TickedTask struct {
+	TaskID  int       `json:"task_id"`
+	NextRun time.Time `json:"next_run"`
+}
+
+// FireDue immediately starts every scheduled task whose next run falls
+// within window from now, as though the scheduler had ticked. The tasks run
+// through the same job as a real tick, so pauses, skip windows and run
+// conditions still apply. It exists for testing schedules and is only
+// exposed when DEV_MODE is set.
+func (e *Engine) FireDue(window time.Duration) []TickedTask {
+	e.mu.Lock()
+	now := e.Now()
+	fired := []TickedTask{}
+	var jobs []cron.Job
+	for taskID, entryIDs := range e.entries {
+		// Every entry of a task shares its job; fire it once, for the
+		// soonest of them.
+		var next time.Time
+		var job cron.Job
+		for _, entryID := range entryIDs {
+			entry := e.cron.Entry(entryID)
+			if !entry.Valid() {
+				continue
+			}
+			if at := entry.Schedule.Next(now); !at.IsZero() && (next.IsZero() || at.Before(next)) {
+				next, job = at, entry.Job
+			}
+		}
+		if next.IsZero() || next.After(now.Add(window)) {
+			continue
+		}
+		fired = append(fired, TickedTask{TaskID: taskID, NextRun: next})
+		jobs = append(jobs, job)
+	}
+	e.mu.Unlock()
+
+	for _, job := range jobs {
+		go job.Run()
+	}
+	sort.Slice(fired, func(i, j int) bool { return fired[i].TaskID < fired[j].TaskID })
+	return fired
+}
+
+// inEnvironment reports whether t should be scheduled in this deployment: its
+// Environments list is empty or contains the engine's Environment.
+func (e *Engine) inEnvironment(t models.Task) bool {
+	if len(t.Environments) == 0 {
+		return true
+	}
+	for _, env := range t.Environments {
+		if env == e.Environment {
+			return true
+		}
+	}
+	return false
+}
+
+// addTask installs one cron entry per schedule expression of t, all running
+// the same job. Expressions that fire at the same moment run the task once.
+func (e *Engine) addTask(t models.Task) error {
+	scheds, err := taskSchedules(t)
+	if err != nil {
+		log.Printf("Failed to schedule task %s: %v", t.Name, err)
+		return err
+	}
+	var fireMu sync.Mutex
+	var lastFire time.Time
+	job := cron.FuncJob(func() {
+		defer recoverJob(t)
+		if len(scheds) > 1 {
+			now := time.Now().Truncate(time.Second)
+			fireMu.Lock()
+			coincident := now.Equal(lastFire)
+			lastFire = now
+			fireMu.Unlock()
+			if coincident {
+				return
+			}
+		}
 		if _, err := e.runTask(t); err != nil {
+			if errors.Is(err, ErrMaxInstances) || errors.Is(err, ErrRunConditionNotMet) || errors.Is(err, ErrNotStartable) {
+				log.Printf("Skipping task %s: %v", t.Name, err)
+				return
+			}
 			log.Printf("Task %s failed: %v", t.Name, err)
 		}
 	})
+	for _, sched := range scheds {
+		e.entries[t.ID] = append(e.entries[t.ID], e.cron.Schedule(sched, job))
+	}
+	return nil
+}
 
+// recoverJob logs a panic in the scheduled job of t instead of letting it
+// crash the process, since cron runs jobs in goroutines without recovery.
+// Panics during a run are already recovered by executeRun, which fails the
+// run; this catches the rest.
+func recoverJob(t models.Task) {
+	if p := recover(); p != nil {
+		log.Printf("Recovered panic in scheduled job of task %s (%d): %v\n%s", t.Name, t.ID, p, debug.Stack())
+	}
+}
+
+// NextRuns returns the next n fire times of the cron spec after from.
+func NextRuns(spec string, from time.Time, n int) ([]time.Time, error) {
+	sched, err := ParseSchedule(spec)
 	if err != nil {
-		log.Printf("Failed to schedule task %s: %v", t.Name, err)
-	} else {
-		e.entries[t.ID] = entryID
+		return nil, err
+	}
+	return nextRuns(sched, from, n), nil
+}
+
+// NextTaskRuns is NextRuns for a stored task, honoring schedules relative to
+// its creation.
+func NextTaskRuns(t models.Task, from time.Time, n int) ([]time.Time, error) {
+	sched, err := TaskSchedule(t)
+	if err != nil {
+		return nil, err
+	}
+	return nextRuns(sched, from, n), nil
+}
+
+func nextRuns(sched cron.Schedule, from time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	next := from
+	for i := 0; i < n; i++ {
+		next = sched.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next)
 	}
+	return runs
 }
 
 func (e *Engine) RefreshTask(taskID int) {
 	e.Reload() // Simplistic approach: reload all on change for now
 }
 
-func (e *Engine) RunTaskNow(taskID int) error {
+func (e *Engine) getTask(taskID int) (*models.Task, error) {
 	t, err := e.store.GetTaskByID(taskID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("task %d not found: %w", taskID, sql.ErrNoRows)
+			return nil, fmt.Errorf("task %d not found: %w", taskID, sql.ErrNoRows)
 		}
-		return err
+		return nil, err
+	}
+	return t, nil
+}
+
+// RunResult summarizes a finished run for callers that waited on it.
+type RunResult struct {
+	RunID    int  `json:"run_id"`
+	Success  bool `json:"success"`
+	ExitCode int  `json:"exit_code"`
+	// DurationMS is the wall-clock run time in milliseconds.
+	DurationMS int64 `json:"duration_ms"`
+	// Output is the tail of the run's combined stdout and stderr.
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+	// Err is the run's error, as also returned alongside the result.
+	Err error `json:"-"`
+}
+
+// outputTailBytes is how much trailing output a RunResult keeps.
+const outputTailBytes = 1024
+
+// RunTaskSync runs the task on the caller's goroutine and returns once the
+// command has finished.
+func (e *Engine) RunTaskSync(taskID int) (*RunResult, error) {
+	t, err := e.getTask(taskID)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = e.runTask(*t)
-	return err
+	return e.runTask(*t)
+}
+
+// DryRunResult describes what a run of a task would execute.
+type DryRunResult struct {
+	// Commands are the fully resolved command lines, one per step.
+	Commands []string `json:"commands"`
+	// Dir is the working directory; empty with FreshWorkdir, which creates
+	// a new one per run.
+	Dir          string `json:"dir"`
+	FreshWorkdir bool   `json:"fresh_workdir"`
+	User         string `json:"user"`
+}
+
+// DryRunTask resolves the task's commands as a run would, including env
+// interpolation, the command wrapper and loading its env file, without
+// executing anything. Resolution errors are returned as a run would fail.
+// Remote scripts are checked against the allowed hosts but not fetched.
+func (e *Engine) DryRunTask(taskID int) (*DryRunResult, error) {
+	t, err := e.getTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := taskSteps(*t)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.taskEnv(*t); err != nil {
+		return nil, err
+	}
+	result := &DryRunResult{FreshWorkdir: t.FreshWorkdir}
+	for _, step := range steps {
+		if _, ok := e.executorFor(step); ok {
+			result.Commands = append(result.Commands, step)
+			continue
+		}
+		// A remote script is reported by its URL; fetching it is left to
+		// the real run.
+		if isRemoteScript(step) {
+			if _, err := e.parseScriptURL(*t, step); err != nil {
+				return nil, err
+			}
+			result.Commands = append(result.Commands, strings.TrimSpace(step))
+			continue
+		}
+		resolved, err := e.resolveCommand(*t, step)
+		if err != nil {
+			return nil, err
+		}
+		result.Commands = append(result.Commands, resolved)
+	}
+	if !t.FreshWorkdir {
+		result.Dir, _ = os.Getwd()
+	}
+	if u, err := user.Current(); err == nil {
+		result.User = u.Username
+	}
+	log.Printf("Dry run of task %s: would run %q in %q as %s", t.Name, result.Commands, result.Dir, result.User)
+	return result, nil
+}
+
+// RunTaskNow launches a run of the task in the background and returns its run
+// id straight away; poll the run history for its status. done receives the
+// run's result once it finishes.
+func (e *Engine) RunTaskNow(taskID int) (runID int, done <-chan *RunResult, err error) {
+	return e.RunTaskWithProgress(taskID, nil)
 }
 
-func (e *Engine) runTask(t models.Task) (deleted bool, err error) {
-	log.Printf("Running task %s: %s", t.Name, t.Command)
+// RunTaskWithProgress is RunTaskNow that also copies the command's combined
+// output to progress as it is produced. progress may be written to from
+// several goroutines at once.
+func (e *Engine) RunTaskWithProgress(taskID int, progress io.Writer) (runID int, done <-chan *RunResult, err error) {
+	t, err := e.getTask(taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := e.acquireInstance(*t); err != nil {
+		return 0, nil, err
+	}
+	run := e.beginRun(*t, time.Now())
+	ch := make(chan *RunResult, 1)
+	go func() {
+		defer e.releaseInstance(t.ID)
+		result, _ := e.executeRun(*t, run, progress)
+		ch <- result
+	}()
+	return run.ID, ch, nil
+}
+
+func (e *Engine) runTask(t models.Task) (*RunResult, error) {
+	if err := e.checkStartable(t, e.Now()); err != nil {
+		return nil, err
+	}
+	if err := e.checkRunCondition(t); err != nil {
+		return nil, err
+	}
+	if err := e.acquireInstance(t); err != nil {
+		return nil, err
+	}
+	defer e.releaseInstance(t.ID)
+	return e.executeRun(t, e.beginRun(t, time.Now()), nil)
+}
+
+// checkStartable returns ErrNotStartable if t is snoozed, before its
+// StartAfter, or inside a skip window at now. Scheduled fires and missed-run
+// catch-ups both go through it.
+func (e *Engine) checkStartable(t models.Task, now time.Time) error {
+	if now.Before(t.PausedUntil) {
+		return fmt.Errorf("task %s: %w: paused until %s", t.Name, ErrNotStartable, t.PausedUntil.Format(time.RFC3339))
+	}
+	if now.Before(t.StartAfter) {
+		return fmt.Errorf("task %s: %w: not starting until %s", t.Name, ErrNotStartable, t.StartAfter.Format(time.RFC3339))
+	}
+	if w, ok := inSkipWindow(t.SkipWindows, now); ok {
+		return fmt.Errorf("task %s: %w: inside skip window %s-%s", t.Name, ErrNotStartable, w[0], w[1])
+	}
+	return nil
+}
+
+// checkRunCondition evaluates the task's RunCondition against its previous
+// outcome, recording a skipped run if it does not hold. A task that has never
+// run meets on_prev_success but not on_prev_failure.
+func (e *Engine) checkRunCondition(t models.Task) error {
+	if t.RunCondition == "" || t.RunCondition == models.RunConditionAlways {
+		return nil
+	}
+	prev, err := e.store.LastOutcome(t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check run condition: %w", err)
+	}
+	var reason string
+	switch t.RunCondition {
+	case models.RunConditionOnPrevSuccess:
+		if prev == models.RunStatusFailed {
+			reason = "previous run failed"
+		}
+	case models.RunConditionOnPrevFailure:
+		if prev != models.RunStatusFailed {
+			reason = "previous run did not fail"
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+
 	now := time.Now()
+	run := &models.Run{
+		TaskID:     t.ID,
+		Status:     models.RunStatusSkipped,
+		Error:      fmt.Sprintf("skipped: %s (run_condition %s)", reason, t.RunCondition),
+		StartedAt:  now,
+		FinishedAt: now,
+	}
+	if err := e.store.CreateRun(run); err != nil {
+		log.Printf("Failed to record skipped run for task %s (%d): %v", t.Name, t.ID, err)
+	}
+	return fmt.Errorf("task %s: %w: %s", t.Name, ErrRunConditionNotMet, reason)
+}
+
+// acquireInstance claims one of the task's concurrent run slots. MaxInstances
+// of zero or less means unlimited.
+func (e *Engine) acquireInstance(t models.Task) error {
+	e.runningMu.Lock()
+	defer e.runningMu.Unlock()
+	if t.MaxInstances > 0 && e.running[t.ID] >= t.MaxInstances {
+		return fmt.Errorf("task %s: %w (%d)", t.Name, ErrMaxInstances, t.MaxInstances)
+	}
+	e.running[t.ID]++
+	return nil
+}
+
+func (e *Engine) releaseInstance(taskID int) {
+	e.runningMu.Lock()
+	defer e.runningMu.Unlock()
+	e.running[taskID]--
+	if e.running[taskID] <= 0 {
+		delete(e.running, taskID)
+	}
+}
+
+// QueuedRun is a run in the execution queue.
+type QueuedRun struct {
+	RunID     int       `json:"run_id"`
+	TaskID    int       `json:"task_id"`
+	TaskName  string    `json:"task_name"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ExecutionQueue lists the runs in progress, oldest first. Queued is always
+// empty for now: a run over a task's max_instances is skipped, not queued.
+type ExecutionQueue struct {
+	Running []QueuedRun `json:"running"`
+	Queued  []QueuedRun `json:"queued"`
+}
+
+// Queue returns the current execution queue.
+func (e *Engine) Queue() ExecutionQueue {
+	e.runningMu.Lock()
+	q := ExecutionQueue{Running: make([]QueuedRun, 0, len(e.activeRuns)), Queued: []QueuedRun{}}
+	for run, name := range e.activeRuns {
+		q.Running = append(q.Running, QueuedRun{RunID: run.ID, TaskID: run.TaskID, TaskName: name, StartedAt: run.StartedAt})
+	}
+	e.runningMu.Unlock()
+	sort.Slice(q.Running, func(i, j int) bool {
+		if !q.Running[i].StartedAt.Equal(q.Running[j].StartedAt) {
+			return q.Running[i].StartedAt.Before(q.Running[j].StartedAt)
+		}
+		return q.Running[i].RunID < q.Running[j].RunID
+	})
+	return q
+}
+
+// beginRun records a running entry in the run history before the command
+// starts, so its id can be handed out immediately. The run is listed by Queue
+// until executeRun finishes it.
+func (e *Engine) beginRun(t models.Task, now time.Time) *models.Run {
+	run := &models.Run{
+		TaskID:    t.ID,
+		Status:    models.RunStatusRunning,
+		LogFile:   logFileName(t.ID, e.LogRotation, now),
+		StartedAt: now,
+	}
+	if err := e.store.CreateRun(run); err != nil {
+		log.Printf("Failed to record run for task %s (%d): %v", t.Name, t.ID, err)
+	}
+	e.runningMu.Lock()
+	e.activeRuns[run] = t.Name
+	e.runningMu.Unlock()
+	return run
+}
+
+func (e *Engine) executeRun(t models.Task, run *models.Run, progress io.Writer) (result *RunResult, err error) {
+	result = &RunResult{RunID: run.ID}
+	output := &tailBuffer{max: outputTailBytes}
+	defer func() {
+		// A panic fails the run instead of taking down the process.
+		if p := recover(); p != nil {
+			log.Printf("Recovered panic in task %s (%d): %v\n%s", t.Name, t.ID, p, debug.Stack())
+			err = fmt.Errorf("panic: %v", p)
+		}
+		e.runningMu.Lock()
+		delete(e.activeRuns, run)
+		e.runningMu.Unlock()
+		result.Success = err == nil
+		result.DurationMS = time.Since(run.StartedAt).Milliseconds()
+		result.Output = output.String()
+		if err != nil {
+			result.Err = err
+			result.Error = err.Error()
+			if result.ExitCode == 0 {
+				result.ExitCode = -1
+			}
+		}
+		e.finishRun(t, run, err)
+	}()
+
+	log.Printf("Running task %s: %s", t.Name, PlatformCommand(t, runtime.GOOS))
+	now := run.StartedAt
 	if err := e.store.UpdateLastRun(t.ID, now); err != nil {
 		log.Printf("Failed to update last_run for task %s (%d): %v", t.Name, t.ID, err)
 	}
 
 	logsDir := filepath.Join(e.dataDir, "logs")
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		return false, fmt.Errorf("failed to create logs directory: %w", err)
+		return result, fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
-	logPath := filepath.Join(logsDir, fmt.Sprintf("task_%d_%s.log", t.ID, now.Format("20060102")))
+	logPath := filepath.Join(logsDir, run.LogFile)
 	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return false, fmt.Errorf("failed to open log file: %w", err)
+		return result, fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		run.LogOffset = info.Size()
+		if run.ID != 0 {
+			if err := e.store.SetRunLogOffset(run.ID, run.LogOffset); err != nil {
+				log.Printf("Failed to record log offset of run %d: %v", run.ID, err)
+			}
+		}
+	}
 
-	fmt.Fprintf(f, "\n--- Task %s started at %s ---\n", t.Name, now.Format(time.RFC3339))
+	marks := e.markers(t, run, f)
+	marks.start(now)
 
-	if t.Command == "" {
-		fmt.Fprintf(f, "--- Task %s failed: empty command ---\n", t.Name)
-		return false, fmt.Errorf("empty command")
+	steps, err := taskSteps(t)
+	if err != nil {
+		marks.finish(err)
+		return result, err
+	}
+	if err := e.SandboxConflict(t); err != nil {
+		marks.finish(err)
+		return result, err
 	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", t.Command)
-	} else {
-		cmd = exec.Command("sh", "-c", t.Command)
+	env, err := e.taskEnv(t)
+	if err != nil {
+		marks.finish(err)
+		return result, err
+	}
+	// A sandboxed run always gets its own directory, since whatever is
+	// mounted into the container is writable from inside it.
+	var dir string
+	if t.FreshWorkdir || t.Sandbox {
+		var mkErr error
+		dir, mkErr = os.MkdirTemp("", fmt.Sprintf("opencron_task_%d_", t.ID))
+		if mkErr != nil {
+			marks.finish(fmt.Errorf("could not create working directory: %v", mkErr))
+			return result, fmt.Errorf("failed to create working directory: %w", mkErr)
+		}
+		log.Printf("Task %s using fresh working directory %s", t.Name, dir)
+		marks.notef("Working directory: %s", dir)
+		defer func() {
+			if err != nil && t.KeepWorkdirOnFailure {
+				log.Printf("Keeping working directory %s of failed task %s", dir, t.Name)
+				return
+			}
+			if rmErr := os.RemoveAll(dir); rmErr != nil {
+				log.Printf("Failed to remove working directory %s: %v", dir, rmErr)
+			}
+		}()
+	}
+
+	// Command output goes to the log file and, with an OutputCommand, to that
+	// command's stdin; OutputCommandOnly leaves just the run markers in the
+	// log file.
+	var fileOut io.Writer = f
+	var stamped *timestampWriter
+	if t.TimestampLines {
+		stamped = &timestampWriter{w: f}
+		fileOut = stamped
+	}
+	taskOut := fileOut
+	var captured io.Writer = output
+	if progress != nil {
+		captured = io.MultiWriter(output, progress)
+	}
+	// The output command is closed before the run's finish marker, and its
+	// failure fails the run.
+	var sink *outputSink
+	closeSink := func() error {
+		if sink == nil {
+			return nil
+		}
+		s := sink
+		sink = nil
+		return s.Close()
+	}
+	defer closeSink()
+	if t.OutputCommand != "" {
+		sink, err = startOutputSink(t.OutputCommand, env, dir, f, marks)
+		if err != nil {
+			marks.finish(err)
+			return result, err
+		}
+		if t.OutputCommandOnly {
+			taskOut = sink
+		} else {
+			taskOut = io.MultiWriter(fileOut, sink)
+		}
+	}
+
+	// A task's own timeout, or failing that its folder's, takes precedence
+	// over the server default.
+	timeoutSeconds, killGraceSeconds := e.runLimits(t)
+	timeout, timeoutKind := e.DefaultTimeout, "default timeout"
+	if timeoutSeconds > 0 {
+		timeout, timeoutKind = time.Duration(timeoutSeconds)*time.Second, "timeout"
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// With multiple steps, the first failing step is reported; later steps
+	// only run if ContinueOnError is set.
+	multiStep := len(t.Steps) > 0
+	var runErr error
+	for i, step := range steps {
+		if multiStep {
+			marks.notef("Step %d/%d", i+1, len(steps))
+		}
+		stderr := &tailBuffer{max: stderrTailBytes}
+		var err error
+		executorCode := 0
+		if ex, ok := e.executorFor(step); ok {
+			executorCode, err = runExecutor(ctx, ex, t, step, io.MultiWriter(taskOut, captured))
+		} else {
+			var resolved string
+			if resolved, err = e.resolveCommand(t, step); err != nil {
+				closeSink()
+				marks.finish(err)
+				return result, err
+			}
+			step = resolved
+			if e.CommandWrapper != nil {
+				marks.notef("Wrapped command: %s", step)
+			}
+			var cmd *exec.Cmd
+			if t.Sandbox {
+				name := sandboxContainerName(run.ID, i+1)
+				if cmd, err = e.sandboxCommand(ctx, t, step, dir, name, killGraceSeconds); err != nil {
+					closeSink()
+					marks.finish(err)
+					return result, err
+				}
+			} else {
+				cmd = shellCommand(ctx, step)
+				// Output goes through pipes, so don't let orphaned
+				// children keep a killed command's Wait from returning.
+				cmd.WaitDelay = time.Second
+				if killGraceSeconds > 0 {
+					// On timeout, ask the command to stop and kill it
+					// only once the grace period is over.
+					cmd.Cancel = func() error { return terminate(cmd.Process) }
+					cmd.WaitDelay = time.Duration(killGraceSeconds) * time.Second
+				}
+			}
+			cmd.Env = env
+			cmd.Dir = dir
+			cmd.Stdout = io.MultiWriter(taskOut, captured)
+			cmd.Stderr = io.MultiWriter(taskOut, stderr, captured)
+			err = e.runCommand(t, cmd, marks)
+		}
+		if stamped != nil {
+			stamped.Flush()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil && successExitCode(t, exitErr.ExitCode()) {
+			marks.notef("Exit code %d treated as success", exitErr.ExitCode())
+			result.ExitCode = exitErr.ExitCode()
+			err = nil
+		}
+		if err != nil {
+			timedOut := ctx.Err() == context.DeadlineExceeded
+			if timedOut {
+				log.Printf("Task %s killed after %s of %s", t.Name, timeoutKind, timeout)
+				err = fmt.Errorf("killed after %s of %s", timeoutKind, timeout)
+			} else if tail := strings.TrimSpace(stderr.String()); tail != "" {
+				err = fmt.Errorf("%w: %s", err, tail)
+			}
+			if multiStep {
+				marks.notef("Step %d/%d failed: %v", i+1, len(steps), err)
+				err = fmt.Errorf("step %d/%d: %w", i+1, len(steps), err)
+			}
+			if runErr == nil {
+				runErr = err
+				if exitErr != nil {
+					result.ExitCode = exitErr.ExitCode()
+				} else if executorCode != 0 {
+					result.ExitCode = executorCode
+				}
+				if multiStep {
+					run.FailedStep = i + 1
+				}
+			}
+			if timedOut || !t.ContinueOnError {
+				break
+			}
+		}
 	}
-	cmd.Stdout = f
-	cmd.Stderr = f
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(f, "--- Task %s failed: %v ---\n", t.Name, err)
-		return false, err
+	if sinkErr := closeSink(); sinkErr != nil && runErr == nil {
+		runErr = sinkErr
+	}
+	if runErr != nil {
+		marks.finish(runErr)
+		return result, runErr
 	}
 
 	log.Printf("Task %s finished.", t.Name)
-	fmt.Fprintf(f, "--- Task %s finished successfully ---\n", t.Name)
+	marks.finish(nil)
 
 	if t.OneShot {
-		if err := e.store.DeleteTask(t.ID); err != nil {
-			fmt.Fprintf(f, "--- Failed to delete one-shot task: %v ---\n", err)
-			return false, fmt.Errorf("failed to delete one-shot task: %w", err)
+		// The task asked to be deleted once it ran, lock or not.
+		if err := e.store.DeleteTask(t.ID, true); err != nil {
+			marks.notef("Failed to delete one-shot task: %v", err)
+			return result, fmt.Errorf("failed to delete one-shot task: %w", err)
 		}
 		log.Printf("One-shot task %s (%d) deleted after first run.", t.Name, t.ID)
-		fmt.Fprintf(f, "--- One-shot task deleted after first run ---\n")
+		marks.notef("One-shot task deleted after first run")
 		e.Reload()
-		return true, nil
+		return result, nil
 	}
 
-	return false, nil
+	return result, nil
+}
+
+// runExecutor runs one step of t with an in-process executor, writing its
+// output to out, and returns the exit code it reports. A non-zero exit code
+// fails the step even if the executor returned no error.
+func runExecutor(ctx context.Context, ex Executor, t models.Task, step string, out io.Writer) (int, error) {
+	t.Command = step
+	res, err := ex.Run(ctx, t)
+	if res.Output != "" {
+		io.WriteString(out, res.Output)
+	}
+	if err == nil && res.ExitCode != 0 {
+		err = fmt.Errorf("exit status %d", res.ExitCode)
+	}
+	return res.ExitCode, err
+}
+
+// runCommand starts cmd at the task's Nice and waits for it. If the niceness
+// can't be set the error is returned and the command doesn't run, unless the
+// platform lacks support, which is only logged.
+func (e *Engine) runCommand(t models.Task, cmd *exec.Cmd, marks *logMarkers) error {
+	// A sandboxed command's niceness is set inside its container.
+	if t.Nice == 0 || t.Sandbox {
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+	} else if err := startNiced(cmd, t.Nice); errors.Is(err, errNiceUnsupported) {
+		log.Printf("Ignoring nice %d for task %s: %v", t.Nice, t.Name, err)
+		marks.notef("Ignoring nice %d: %v", t.Nice, err)
+	} else if err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+func (e *Engine) finishRun(t models.Task, run *models.Run, err error) {
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	if err := e.store.SetLastError(t.ID, lastError); err != nil {
+		log.Printf("Failed to record last error for task %s (%d): %v", t.Name, t.ID, err)
+	}
+	if run.ID == 0 {
+		return
+	}
+	// Runs of the same task overlapping in time interleave their output, so
+	// the recorded range may include some of the other run's lines.
+	if info, err := os.Stat(filepath.Join(e.dataDir, "logs", run.LogFile)); err == nil && info.Size() > run.LogOffset {
+		run.LogLength = info.Size() - run.LogOffset
+	}
+	run.FinishedAt = time.Now()
+	run.Status = models.RunStatusSuccess
+	if err != nil {
+		run.Status = models.RunStatusFailed
+		run.Error = err.Error()
+	}
+	if err := e.store.FinishRun(run); err != nil {
+		log.Printf("Failed to finish run #%d for task %d: %v", run.ID, run.TaskID, err)
+		return
+	}
+	e.notifyRun(t, run, e.autoDisable(t, run))
+}
+
+// autoDisable disables t once it has failed AutoDisableAfterFailures times in
+// a row, reporting whether it did. The task stays disabled until an operator
+// re-enables or resets it.
+func (e *Engine) autoDisable(t models.Task, run *models.Run) bool {
+	if t.AutoDisableAfterFailures <= 0 || run.Status != models.RunStatusFailed || !t.Enabled {
+		return false
+	}
+	failures, err := e.store.ConsecutiveFailures(t.ID)
+	if err != nil {
+		log.Printf("Failed to count failures for task %s (%d): %v", t.Name, t.ID, err)
+		return false
+	}
+	if failures < t.AutoDisableAfterFailures {
+		return false
+	}
+	disabled, err := e.store.AutoDisableTask(t.ID)
+	if err != nil {
+		log.Printf("Failed to auto-disable task %s (%d): %v", t.Name, t.ID, err)
+		return false
+	}
+	if !disabled {
+		return false
+	}
+	log.Printf("Disabled task %s (%d) after %d consecutive failures", t.Name, t.ID, failures)
+	e.RefreshTask(t.ID)
+	return true
+}
+
+// successExitCode reports whether code counts as success for the task:
+// listed in SuccessExitCodes, or zero if the list is empty.
+func successExitCode(t models.Task, code int) bool {
+	if len(t.SuccessExitCodes) == 0 {
+		return code == 0
+	}
+	for _, c := range t.SuccessExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// stderrTailBytes is how much trailing stderr a failed command's error keeps.
+const stderrTailBytes = 512
+
+// tailBuffer is an io.Writer that keeps only the last max bytes written.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+// expandEnv resolves {{env "VAR"}} references in command against the
+// server's environment. Unset variables are an error rather than expanding
+// to an empty string.
+func expandEnv(command string) (string, error) {
+	tmpl, err := template.New("command").Funcs(template.FuncMap{
+		"env": func(name string) (string, error) {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return value, nil
+		},
+	}).Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse command template: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil); err != nil {
+		return "", fmt.Errorf("failed to expand command: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// taskSteps returns the command lines a run executes: the task's Steps, else
+// its CommandFile, else its command for this platform.
+func taskSteps(t models.Task) ([]string, error) {
+	if len(t.Steps) > 0 {
+		return t.Steps, nil
+	}
+	if t.CommandFile != "" {
+		command, err := commandFileCommand(t.CommandFile)
+		if err != nil {
+			return nil, err
+		}
+		return []string{command}, nil
+	}
+	command := PlatformCommand(t, runtime.GOOS)
+	if command == "" {
+		return nil, fmt.Errorf("empty command")
+	}
+	return []string{command}, nil
+}
+
+// PlatformCommand returns the command t runs on goos: CommandWindows on
+// windows or CommandUnix elsewhere, if set, otherwise Command.
+func PlatformCommand(t models.Task, goos string) string {
+	if goos == "windows" && t.CommandWindows != "" {
+		return t.CommandWindows
+	}
+	if goos != "windows" && t.CommandUnix != "" {
+		return t.CommandUnix
+	}
+	return t.Command
+}
+
+// commandFileCommand returns the command line that runs the script at path:
+// the script itself if it is executable, otherwise the script fed to sh.
+func commandFileCommand(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("command file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("command file %s is a directory", path)
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`, nil
+	}
+	quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	if info.Mode()&0111 != 0 {
+		return quoted, nil
+	}
+	return "sh " + quoted, nil
+}
+
+// resolveCommand applies the task's env interpolation and the server's
+// command wrapper to a command or step, giving the line the shell runs. A
+// command that is a script URL is replaced by a run of the fetched script.
+func (e *Engine) resolveCommand(t models.Task, command string) (string, error) {
+	if isRemoteScript(command) {
+		local, err := e.remoteScriptCommand(t, command)
+		if err != nil {
+			return "", err
+		}
+		command = local
+	} else if t.ExpandEnv {
+		expanded, err := expandEnv(command)
+		if err != nil {
+			return "", err
+		}
+		command = expanded
+	}
+	if e.CommandWrapper != nil {
+		return wrapCommand(e.CommandWrapper, command)
+	}
+	return command, nil
+}
+
+// wrapCommand renders the command wrapper template around command.
+func wrapCommand(wrapper *template.Template, command string) (string, error) {
+	var sb strings.Builder
+	if err := wrapper.Execute(&sb, struct{ Command string }{command}); err != nil {
+		return "", fmt.Errorf("failed to apply command wrapper: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// terminate asks p to exit: SIGTERM on Unix. Windows has no equivalent, so
+// p is killed outright.
+func terminate(p *os.Process) error {
+	if runtime.GOOS == "windows" {
+		return p.Kill()
+	}
+	return p.Signal(syscall.SIGTERM)
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// LoadGlobalEnv (re)reads GlobalEnvFile. On error the previously loaded
+// variables are kept.
+func (e *Engine) LoadGlobalEnv() error {
+	if e.GlobalEnvFile == "" {
+		return nil
+	}
+	vars, err := godotenv.Read(e.GlobalEnvFile)
+	if err != nil {
+		return fmt.Errorf("failed to load global env file %s: %w", e.GlobalEnvFile, err)
+	}
+	e.globalEnvMu.Lock()
+	e.globalEnv = vars
+	e.globalEnvMu.Unlock()
+	return nil
+}
+
+// taskEnv builds the environment for a task's commands, or returns nil to
+// inherit the server's environment unchanged. The global env file is applied
+// first, so the task's env_file wins on conflicting keys.
+func (e *Engine) taskEnv(t models.Task) ([]string, error) {
+	e.globalEnvMu.RLock()
+	global := e.globalEnv
+	e.globalEnvMu.RUnlock()
+	if t.EnvFile == "" && len(t.ExtraPath) == 0 && len(global) == 0 {
+		return nil, nil
+	}
+	env := os.Environ()
+	if len(global) > 0 {
+		env = mergeEnv(env, global)
+	}
+	if t.EnvFile != "" {
+		vars, err := godotenv.Read(t.EnvFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load env file %s: %w", t.EnvFile, err)
+		}
+		env = mergeEnv(env, vars)
+	}
+	if len(t.ExtraPath) > 0 {
+		env = prependPath(env, t.ExtraPath)
+	}
+	return env, nil
+}
+
+// mergeEnv returns env with vars set, replacing existing entries of the same
+// key.
+func mergeEnv(env []string, vars map[string]string) []string {
+	result := make([]string, 0, len(env)+len(vars))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := vars[key]; !ok {
+			result = append(result, kv)
+		}
+	}
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result = append(result, key+"="+vars[key])
+	}
+	return result
+}
+
+// prependPath returns env with dirs prepended to its PATH entry, adding one if
+// the environment has none.
+func prependPath(env []string, dirs []string) []string {
+	prefix := strings.Join(dirs, string(os.PathListSeparator))
+	result := make([]string, 0, len(env)+1)
+	found := false
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		// Windows spells it "Path", so match case-insensitively.
+		if strings.EqualFold(key, "PATH") && !found {
+			found = true
+			if value != "" {
+				kv = key + "=" + prefix + string(os.PathListSeparator) + value
+			} else {
+				kv = key + "=" + prefix
+			}
+		}
+		result = append(result, kv)
+	}
+	if !found {
+		result = append(result, "PATH="+prefix)
+	}
+	return result
 }
@@ -0,0 +1,756 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+	"github.com/opencron/opencron/internal/store"
+)
+
+func newTestEngine(t *testing.T) (*Engine, string) {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	s, err := store.New(filepath.Join(dataDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return New(s, dataDir, 48*time.Hour), dataDir
+}
+
+func TestRunTaskExtraPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	e, _ := newTestEngine(t)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho found\n"
+	if err := os.WriteFile(filepath.Join(binDir, "opencron-extra-tool"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write tool: %v", err)
+	}
+
+	task := models.Task{ID: 1, Name: "extra", Command: "opencron-extra-tool"}
+	if _, err := e.runTask(task); err == nil {
+		t.Fatalf("expected tool to be missing from the default PATH")
+	}
+
+	task.ExtraPath = []string{binDir}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected tool to be found via extra path, got: %v", err)
+	}
+}
+
+func TestPrependPath(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	env := prependPath([]string{"HOME=/root", "PATH=/usr/bin"}, []string{"/opt/bin", "/opt/tools"})
+	want := "PATH=/opt/bin" + sep + "/opt/tools" + sep + "/usr/bin"
+	if env[1] != want {
+		t.Fatalf("expected %q, got %q", want, env[1])
+	}
+
+	env = prependPath([]string{"HOME=/root"}, []string{"/opt/bin"})
+	if !strings.HasPrefix(env[len(env)-1], "PATH=/opt/bin") {
+		t.Fatalf("expected PATH to be added, got %v", env)
+	}
+}
+
+func workdirFromLog(t *testing.T, dataDir string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(dataDir, "logs", fmt.Sprintf("task_1_%s.log", time.Now().Format("20060102"))))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	lines := strings.Split(string(content), "\n")
+	var dir string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "--- Working directory: ") {
+			dir = strings.TrimSuffix(strings.TrimPrefix(line, "--- Working directory: "), " ---")
+		}
+	}
+	if dir == "" {
+		t.Fatalf("expected working directory in log, got %q", content)
+	}
+	return dir
+}
+
+func TestRunTaskFreshWorkdir(t *testing.T) {
+	e, dataDir := newTestEngine(t)
+
+	task := models.Task{ID: 1, Name: "fresh", Command: "echo build > artifact", FreshWorkdir: true}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("runTask failed: %v", err)
+	}
+	dir := workdirFromLog(t, dataDir)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected working directory %s to be removed, got %v", dir, err)
+	}
+
+	task.Command = "exit 1"
+	task.KeepWorkdirOnFailure = true
+	if _, err := e.runTask(task); err == nil {
+		t.Fatalf("expected runTask to fail")
+	}
+	dir = workdirFromLog(t, dataDir)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected working directory %s to be kept after failure, got %v", dir, err)
+	}
+}
+
+func TestRunTaskSteps(t *testing.T) {
+	e, dataDir := newTestEngine(t)
+
+	task := models.Task{ID: 1, Name: "steps", Steps: []string{"echo one", "exit 3", "echo three"}}
+	if _, err := e.runTask(task); err == nil {
+		t.Fatalf("expected runTask to fail on step 2")
+	}
+
+	runs, err := e.store.GetRuns(task.ID)
+	if err != nil {
+		t.Fatalf("failed to read runs: %v", err)
+	}
+	if runs[0].FailedStep != 2 {
+		t.Fatalf("expected failed_step 2, got %d", runs[0].FailedStep)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dataDir, "logs", runs[0].LogFile))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(content), "--- Step 2/3 ---") || strings.Contains(string(content), "three") {
+		t.Fatalf("expected step 3 to be skipped, got %q", content)
+	}
+
+	task.ContinueOnError = true
+	if _, err := e.runTask(task); err == nil {
+		t.Fatalf("expected runTask to report the failed step")
+	}
+	content, err = os.ReadFile(filepath.Join(dataDir, "logs", runs[0].LogFile))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(content), "three") {
+		t.Fatalf("expected step 3 to run with continue_on_error, got %q", content)
+	}
+}
+
+func TestRunTaskEnvFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh test syntax")
+	}
+	e, _ := newTestEngine(t)
+
+	envFile := filepath.Join(t.TempDir(), "task.env")
+	if err := os.WriteFile(envFile, []byte("OPENCRON_TEST_SECRET=from-file\n"), 0600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	task := models.Task{ID: 1, Name: "env", Command: `test "$OPENCRON_TEST_SECRET" = from-file`, EnvFile: envFile}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected env file variables to be set, got: %v", err)
+	}
+
+	task.EnvFile = filepath.Join(t.TempDir(), "missing.env")
+	_, err := e.runTask(task)
+	if err == nil || !strings.Contains(err.Error(), "failed to load env file") {
+		t.Fatalf("expected missing env file to fail the run, got: %v", err)
+	}
+}
+
+func TestRunTaskGlobalEnvFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh test syntax")
+	}
+	e, _ := newTestEngine(t)
+
+	dir := t.TempDir()
+	e.GlobalEnvFile = filepath.Join(dir, "global.env")
+	if err := os.WriteFile(e.GlobalEnvFile, []byte("OPENCRON_TEST_PROXY=global\nOPENCRON_TEST_LANG=global\n"), 0600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	taskEnvFile := filepath.Join(dir, "task.env")
+	if err := os.WriteFile(taskEnvFile, []byte("OPENCRON_TEST_LANG=task\n"), 0600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	if err := e.LoadGlobalEnv(); err != nil {
+		t.Fatalf("LoadGlobalEnv failed: %v", err)
+	}
+
+	task := models.Task{ID: 1, Name: "env", Command: `test "$OPENCRON_TEST_PROXY" = global && test "$OPENCRON_TEST_LANG" = task`, EnvFile: taskEnvFile}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected global variables with task overrides, got: %v", err)
+	}
+
+	// A failed reload keeps the variables already loaded.
+	if err := os.Remove(e.GlobalEnvFile); err != nil {
+		t.Fatalf("failed to remove env file: %v", err)
+	}
+	if err := e.LoadGlobalEnv(); err == nil {
+		t.Fatalf("expected a missing global env file to fail to load")
+	}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected the previous global env to be kept, got: %v", err)
+	}
+}
+
+func TestRunTaskDefaultTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	e, _ := newTestEngine(t)
+	e.DefaultTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := e.runTask(models.Task{ID: 1, Name: "slow", Command: "sleep 5"})
+	if err == nil || !strings.Contains(err.Error(), "default timeout") {
+		t.Fatalf("expected default timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected run to be killed promptly, took %s", elapsed)
+	}
+}
+
+func TestRunTaskCommandWrapper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+	e, dataDir := newTestEngine(t)
+	e.CommandWrapper = template.Must(template.New("wrapper").Parse(`echo wrapped; {{.Command}}`))
+
+	if _, err := e.runTask(models.Task{ID: 1, Name: "wrapped", Command: "echo inner"}); err != nil {
+		t.Fatalf("runTask failed: %v", err)
+	}
+	content, err := os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(content), "wrapped\ninner\n") {
+		t.Fatalf("expected wrapper output before command output, got %q", content)
+	}
+}
+
+func TestRunTaskOutputCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+	e, dataDir := newTestEngine(t)
+	sinkFile := filepath.Join(t.TempDir(), "sink.txt")
+
+	task := models.Task{ID: 1, Name: "piped", Command: "echo streamed", OutputCommand: "cat > " + sinkFile, OutputCommandOnly: true}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("runTask failed: %v", err)
+	}
+	sunk, err := os.ReadFile(sinkFile)
+	if err != nil {
+		t.Fatalf("failed to read sink output: %v", err)
+	}
+	if string(sunk) != "streamed\n" {
+		t.Fatalf("expected output in the sink, got %q", sunk)
+	}
+	content, err := os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if strings.Contains(string(content), "streamed") {
+		t.Fatalf("expected output_command_only to keep output out of the log, got %q", content)
+	}
+
+	// A sink that exits without reading must not fail the run.
+	task.OutputCommand = "true"
+	task.Command = "seq 1 100000"
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected run to survive an early-exiting sink, got: %v", err)
+	}
+
+	// A failing sink fails the run, and is reported before it finishes.
+	task.OutputCommand = "cat >/dev/null; exit 4"
+	task.Command = "echo streamed"
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "output command failed") {
+		t.Fatalf("expected a failing sink to fail the run, got: %v", err)
+	}
+	content, err = os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	logged := string(content)
+	note := strings.LastIndex(logged, "Output command failed")
+	finish := strings.LastIndex(logged, "--- Task piped failed: output command failed")
+	if note < 0 || finish < note {
+		t.Fatalf("expected the sink failure before the finish marker, got %q", logged)
+	}
+}
+
+func TestRunTaskMaxInstances(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "parallel", Schedule: "@yearly", Command: "sleep 0.5", MaxInstances: 2}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	var dones []<-chan *RunResult
+	for i := 0; i < 2; i++ {
+		_, done, err := e.RunTaskNow(task.ID)
+		if err != nil {
+			t.Fatalf("run %d: expected to start, got: %v", i+1, err)
+		}
+		dones = append(dones, done)
+	}
+	if _, _, err := e.RunTaskNow(task.ID); !errors.Is(err, ErrMaxInstances) {
+		t.Fatalf("expected third concurrent run to be refused, got: %v", err)
+	}
+
+	for _, done := range dones {
+		if result := <-done; result.Err != nil {
+			t.Fatalf("run failed: %v", result.Err)
+		}
+	}
+	if _, err := e.RunTaskSync(task.ID); err != nil {
+		t.Fatalf("expected a run once slots are free, got: %v", err)
+	}
+}
+
+func TestRunTaskLastError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "flaky", Schedule: "@yearly", Command: "echo boom >&2; exit 3"}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	result, err := e.RunTaskSync(task.ID)
+	if err == nil {
+		t.Fatalf("expected run to fail")
+	}
+	if result.Success || result.ExitCode != 3 || result.Output != "boom\n" {
+		t.Fatalf("unexpected run result: %+v", result)
+	}
+	got, err := e.store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if got.LastError != "exit status 3: boom" {
+		t.Fatalf("expected last_error with exit code and stderr, got %q", got.LastError)
+	}
+
+	if err := e.store.UpdateTask(&models.Task{ID: task.ID, Name: task.Name, Schedule: task.Schedule, Command: "true"}); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if _, err := e.RunTaskSync(task.ID); err != nil {
+		t.Fatalf("expected run to succeed, got: %v", err)
+	}
+	if got, _ = e.store.GetTaskByID(task.ID); got.LastError != "" {
+		t.Fatalf("expected last_error to be cleared, got %q", got.LastError)
+	}
+}
+
+func TestRunTaskExpandEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh test syntax")
+	}
+	e, _ := newTestEngine(t)
+	t.Setenv("OPENCRON_TEST_DEPLOY", "prod")
+
+	task := models.Task{ID: 1, Name: "expand", Command: `test {{env "OPENCRON_TEST_DEPLOY"}} = prod`, ExpandEnv: true}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected expanded command to succeed, got: %v", err)
+	}
+
+	task.Command = `echo {{env "OPENCRON_TEST_UNSET_VAR"}}`
+	_, err := e.runTask(task)
+	if err == nil || !strings.Contains(err.Error(), "OPENCRON_TEST_UNSET_VAR is not set") {
+		t.Fatalf("expected unset variable to fail the run, got: %v", err)
+	}
+}
+
+func TestMissedRun(t *testing.T) {
+	now := time.Date(2026, 2, 12, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-72 * time.Hour)
+
+	cases := []struct {
+		name string
+		task models.Task
+		want bool
+	}{
+		{"ran after last tick", models.Task{Schedule: "0 3 * * *", CreatedAt: created, LastRun: now.Add(-8 * time.Hour)}, false},
+		{"down across a tick", models.Task{Schedule: "0 3 * * *", CreatedAt: created, LastRun: now.Add(-30 * time.Hour)}, true},
+		{"never ran since creation", models.Task{Schedule: "0 3 * * *", CreatedAt: created}, true},
+		{"created after last tick", models.Task{Schedule: "0 3 * * *", CreatedAt: now.Add(-time.Hour)}, false},
+		{"invalid schedule", models.Task{Schedule: "bogus", CreatedAt: created}, false},
+	}
+	for _, c := range cases {
+		if got := missedRun(c.task, now); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRunTaskSuccessExitCodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "grep", Schedule: "@yearly", Command: "exit 1", SuccessExitCodes: []int{0, 1}, OneShot: true}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	result, err := e.RunTaskSync(task.ID)
+	if err != nil {
+		t.Fatalf("expected exit 1 to count as success, got: %v", err)
+	}
+	if !result.Success || result.ExitCode != 1 {
+		t.Fatalf("unexpected run result: %+v", result)
+	}
+	runs, err := e.store.GetRuns(task.ID)
+	if err != nil || len(runs) != 1 || runs[0].Status != models.RunStatusSuccess {
+		t.Fatalf("expected one successful run, got %+v, %v", runs, err)
+	}
+	if _, err := e.store.GetTaskByID(task.ID); err == nil {
+		t.Fatalf("expected one-shot task to be deleted after a successful run")
+	}
+
+	_, err = e.runTask(models.Task{ID: 99, Name: "other", Command: "exit 2", SuccessExitCodes: []int{0, 1}})
+	if err == nil {
+		t.Fatalf("expected unlisted exit code to fail")
+	}
+}
+
+func TestReloadHonorsEnvironments(t *testing.T) {
+	e, _ := newTestEngine(t)
+	e.Environment = "staging"
+
+	everywhere := &models.Task{Name: "everywhere", Schedule: "@hourly", Command: "echo hi", Enabled: true}
+	prodOnly := &models.Task{Name: "prod-only", Schedule: "@hourly", Command: "echo hi", Enabled: true, Environments: []string{"prod"}}
+	staging := &models.Task{Name: "staging", Schedule: "@hourly", Command: "echo hi", Enabled: true, Environments: []string{"prod", "staging"}}
+	for _, task := range []*models.Task{everywhere, prodOnly, staging} {
+		if err := e.store.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	e.Reload()
+	for _, tc := range []struct {
+		task      *models.Task
+		scheduled bool
+	}{{everywhere, true}, {prodOnly, false}, {staging, true}} {
+		if _, ok := e.entries[tc.task.ID]; ok != tc.scheduled {
+			t.Errorf("task %s: expected scheduled=%v in staging, got %v", tc.task.Name, tc.scheduled, ok)
+		}
+	}
+}
+
+func TestMultipleSchedules(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "twice-daily", Schedule: "0 9 * * *", Schedules: []string{"0 17 * * *"}, Command: "echo hi", Enabled: true}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	e.Reload()
+	if got := len(e.entries[task.ID]); got != 2 {
+		t.Fatalf("expected one cron entry per expression, got %d", got)
+	}
+
+	from := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	runs, err := NextTaskRuns(*task, from, 3)
+	if err != nil {
+		t.Fatalf("NextTaskRuns failed: %v", err)
+	}
+	want := []time.Time{
+		time.Date(2026, 3, 2, 17, 0, 0, 0, time.Local),
+		time.Date(2026, 3, 3, 9, 0, 0, 0, time.Local),
+		time.Date(2026, 3, 3, 17, 0, 0, 0, time.Local),
+	}
+	if fmt.Sprint(runs) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, runs)
+	}
+
+	// Schedules alone are enough, and a bad one is reported as such.
+	task.Schedule = ""
+	task.Schedules = []string{"0 9 * * *", "not a cron"}
+	if _, err := TaskSchedule(*task); err == nil || !strings.Contains(err.Error(), `"not a cron"`) {
+		t.Fatalf("expected the invalid expression to be named, got %v", err)
+	}
+	task.Schedules = task.Schedules[:1]
+	if specs := TaskSpecs(*task); len(specs) != 1 || specs[0] != "0 9 * * *" {
+		t.Fatalf("unexpected specs %q", specs)
+	}
+}
+
+func TestRunTaskRunCondition(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "repair", Schedule: "@yearly", Command: "echo repaired", RunCondition: models.RunConditionOnPrevFailure}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	if _, err := e.runTask(*task); !errors.Is(err, ErrRunConditionNotMet) {
+		t.Fatalf("expected a task that never failed to be skipped, got: %v", err)
+	}
+	runs, err := e.store.GetRuns(task.ID)
+	if err != nil || len(runs) != 1 || runs[0].Status != models.RunStatusSkipped {
+		t.Fatalf("expected a recorded skip, got %+v (err %v)", runs, err)
+	}
+
+	task.Command = "exit 1"
+	task.RunCondition = ""
+	if _, err := e.runTask(*task); err == nil {
+		t.Fatalf("expected the failing run to fail")
+	}
+	task.Command = "echo repaired"
+	task.RunCondition = models.RunConditionOnPrevFailure
+	if _, err := e.runTask(*task); err != nil {
+		t.Fatalf("expected the repair to run after a failure, got: %v", err)
+	}
+	if _, err := e.runTask(*task); !errors.Is(err, ErrRunConditionNotMet) {
+		t.Fatalf("expected a skip after the repair succeeded, got: %v", err)
+	}
+}
+
+func TestRunTaskNice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc")
+	}
+	e, dataDir := newTestEngine(t)
+
+	task := models.Task{ID: 1, Name: "background", Command: "awk '{print \"nice=\" $19}' /proc/$$/stat", Nice: 7}
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("runTask failed: %v", err)
+	}
+	content, err := os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(content), "nice=7\n") {
+		t.Fatalf("expected the command to run at nice 7, got %q", content)
+	}
+}
+
+func TestRunTaskCommandFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh scripts")
+	}
+	e, dataDir := newTestEngine(t)
+	scripts := t.TempDir()
+	plain := filepath.Join(scripts, "it's plain.sh")
+	if err := os.WriteFile(plain, []byte("echo from plain script\n"), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	executable := filepath.Join(scripts, "exec.sh")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\necho from executable script\n"), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	for _, path := range []string{plain, executable} {
+		if _, err := e.runTask(models.Task{ID: 1, Name: "scripted", Command: "echo inline", CommandFile: path}); err != nil {
+			t.Fatalf("runTask(%s) failed: %v", path, err)
+		}
+	}
+	content, err := os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	for _, want := range []string{"from plain script\n", "from executable script\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("expected %q in log, got %q", want, content)
+		}
+	}
+	if strings.Contains(string(content), "inline") {
+		t.Fatalf("expected command_file to replace command, got %q", content)
+	}
+
+	if _, err := e.runTask(models.Task{ID: 1, Name: "scripted", CommandFile: filepath.Join(scripts, "missing.sh")}); err == nil {
+		t.Fatalf("expected a missing command file to fail the run")
+	}
+}
+
+func TestRunTaskKillGrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses trap and sleep")
+	}
+	e, dataDir := newTestEngine(t)
+	// The task's timeout wins over the server default.
+	e.DefaultTimeout = time.Hour
+
+	task := models.Task{ID: 1, Name: "graceful", TimeoutSeconds: 1, KillGraceSeconds: 2,
+		Command: "trap 'echo cleaning up; exit 0' TERM; sleep 10 & wait"}
+	start := time.Now()
+	_, err := e.runTask(task)
+	if err == nil || !strings.Contains(err.Error(), "timeout of 1s") {
+		t.Fatalf("expected a timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the run to end within the grace period, took %s", elapsed)
+	}
+	content, err := os.ReadFile(LogFiles(dataDir, 1)[0])
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(content), "cleaning up") {
+		t.Fatalf("expected the command to handle SIGTERM, got log: %s", content)
+	}
+}
+
+// panicTransport panics on every request, standing in for a bug deep inside
+// a run.
+type panicTransport struct{}
+
+func (panicTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	panic("transport exploded")
+}
+
+func TestScheduledJobPanicIsContained(t *testing.T) {
+	e, _ := newTestEngine(t)
+	saved := scriptClient
+	scriptClient = &http.Client{Transport: panicTransport{}}
+	t.Cleanup(func() { scriptClient = saved })
+	e.RemoteScriptHosts = []string{"scripts.example"}
+
+	task := models.Task{Name: "explodes", Schedule: "0 3 * * *", Command: "https://scripts.example/job.sh", Enabled: true}
+	if err := e.store.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	e.Reload()
+	e.cron.Entry(e.entries[task.ID][0]).Job.Run()
+
+	runs, err := e.store.GetRuns(task.ID)
+	if err != nil {
+		t.Fatalf("GetRuns failed: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Status != models.RunStatusFailed || !strings.Contains(runs[0].Error, "panic: transport exploded") {
+		t.Fatalf("expected the panic to fail the run, got %+v", runs)
+	}
+	if len(e.Queue().Running) != 0 {
+		t.Fatalf("expected the run to be released, got %+v", e.Queue())
+	}
+
+	// A panic before the run starts is contained by the job itself.
+	broken := New(nil, t.TempDir(), time.Hour)
+	broken.mu.Lock()
+	err = broken.addTask(models.Task{ID: 1, Name: "no-store", Schedule: "0 3 * * *", Command: "echo hi", Enabled: true})
+	broken.mu.Unlock()
+	if err != nil {
+		t.Fatalf("addTask failed: %v", err)
+	}
+	broken.cron.Entry(broken.entries[1][0]).Job.Run()
+}
+
+func TestPlatformCommand(t *testing.T) {
+	task := models.Task{Command: "echo portable"}
+	if got := PlatformCommand(task, "linux"); got != "echo portable" {
+		t.Fatalf("expected the fallback command, got %q", got)
+	}
+	task.CommandWindows = "echo windows"
+	task.CommandUnix = "echo unix"
+	for goos, want := range map[string]string{"windows": "echo windows", "linux": "echo unix", "darwin": "echo unix"} {
+		if got := PlatformCommand(task, goos); got != want {
+			t.Fatalf("PlatformCommand on %s = %q, want %q", goos, got, want)
+		}
+	}
+
+	e, _ := newTestEngine(t)
+	task = models.Task{ID: 1, Name: "portable", CommandWindows: "echo windows", CommandUnix: "echo unix"}
+	result, err := e.runTask(task)
+	if err != nil {
+		t.Fatalf("expected the run to succeed, got %v", err)
+	}
+	want := "unix"
+	if runtime.GOOS == "windows" {
+		want = "windows"
+	}
+	if strings.TrimSpace(result.Output) != want {
+		t.Fatalf("expected the %s command to run, got %q", want, result.Output)
+	}
+}
+
+func TestRunTaskSkipsSnoozedTask(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "snoozed", Schedule: "@yearly", Command: "echo hi", PausedUntil: time.Now().Add(time.Hour)}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if _, err := e.RunTaskSync(task.ID); !errors.Is(err, ErrNotStartable) {
+		t.Fatalf("expected a snoozed task not to start, got: %v", err)
+	}
+	if runs, err := e.store.GetRuns(task.ID); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no runs, got %+v, %v", runs, err)
+	}
+}
+
+func TestRunTaskSkipsBeforeStartAfter(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	task := &models.Task{Name: "later", Schedule: "@yearly", Command: "echo hi", StartAfter: time.Now().Add(time.Hour)}
+	if err := e.store.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if _, err := e.RunTaskSync(task.ID); !errors.Is(err, ErrNotStartable) {
+		t.Fatalf("expected a task before its start_after not to start, got: %v", err)
+	}
+	if runs, err := e.store.GetRuns(task.ID); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no runs, got %+v, %v", runs, err)
+	}
+}
+
+func TestCatchUpSkipsSnoozedTask(t *testing.T) {
+	e, _ := newTestEngine(t)
+	now := time.Now()
+
+	create := func(name string, pausedUntil time.Time) *models.Task {
+		t.Helper()
+		task := &models.Task{Name: name, Schedule: "@hourly", Command: "echo hi", Enabled: true, MissedRunPolicy: models.MissedRunRunOnce, PausedUntil: pausedUntil}
+		if err := e.store.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		if err := e.store.UpdateLastRun(task.ID, now.Add(-48*time.Hour)); err != nil {
+			t.Fatalf("failed to set last run: %v", err)
+		}
+		return task
+	}
+	snoozed := create("snoozed", now.Add(time.Hour))
+	awake := create("awake", time.Time{})
+
+	e.catchUpMissedRuns(now)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runs, err := e.store.GetRuns(awake.ID)
+		if err != nil {
+			t.Fatalf("failed to list runs: %v", err)
+		}
+		if len(runs) == 1 && runs[0].Status != models.RunStatusRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the awake task to catch up, got %+v", runs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if runs, err := e.store.GetRuns(snoozed.ID); err != nil || len(runs) != 0 {
+		t.Fatalf("expected the snoozed task not to catch up, got %+v, %v", runs, err)
+	}
+}
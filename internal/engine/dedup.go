@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRunDedupWindow is how long a manual run's dedup key is remembered
+// when RunDedupWindow is zero.
+const DefaultRunDedupWindow = time.Minute
+
+// dedupKey identifies manual runs that are duplicates of each other.
+type dedupKey struct {
+	taskID int
+	key    string
+}
+
+// dedupRun is a manual run started with a dedup key. result is set and
+// finished closed once the run is over.
+type dedupRun struct {
+	runID    int
+	started  time.Time
+	finished chan struct{}
+	result   *RunResult
+}
+
+// runDedup remembers recent manual runs by dedup key.
+type runDedup struct {
+	mu   sync.Mutex
+	runs map[dedupKey]*dedupRun
+}
+
+// RunTaskDedup is RunTaskNow for a request carrying a dedup key, such as one
+// a client retries. If a run of the task with the same key was started within
+// RunDedupWindow, no new run is started: that run's id is returned with
+// deduplicated set, and done receives its result, right away if it has
+// already finished. An empty key never deduplicates.
+func (e *Engine) RunTaskDedup(taskID int, key string) (runID int, done <-chan *RunResult, deduplicated bool, err error) {
+	if key == "" {
+		runID, done, err = e.RunTaskNow(taskID)
+		return runID, done, false, err
+	}
+	window := e.RunDedupWindow
+	if window <= 0 {
+		window = DefaultRunDedupWindow
+	}
+
+	d := &e.dedup
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for k, run := range d.runs {
+		if now.Sub(run.started) >= window {
+			delete(d.runs, k)
+		}
+	}
+	k := dedupKey{taskID: taskID, key: key}
+	if run, ok := d.runs[k]; ok {
+		return run.runID, run.wait(), true, nil
+	}
+
+	runID, runDone, err := e.RunTaskNow(taskID)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	run := &dedupRun{runID: runID, started: now, finished: make(chan struct{})}
+	go func() {
+		run.result = <-runDone
+		close(run.finished)
+	}()
+	if d.runs == nil {
+		d.runs = make(map[dedupKey]*dedupRun)
+	}
+	d.runs[k] = run
+	return runID, run.wait(), false, nil
+}
+
+// wait returns a channel that receives the run's result once it finishes.
+func (r *dedupRun) wait() <-chan *RunResult {
+	ch := make(chan *RunResult, 1)
+	go func() {
+		<-r.finished
+		ch <- r.result
+	}()
+	return ch
+}
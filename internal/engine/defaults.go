@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// TaskDefaults are settings applied to tasks in a folder that leave them
+// unset. Zero fields have no effect.
+type TaskDefaults struct {
+	TimeoutSeconds   int `json:"timeout_seconds"`
+	KillGraceSeconds int `json:"kill_grace_seconds"`
+}
+
+// LoadFolderDefaults reads a JSON object mapping folder paths to
+// TaskDefaults, e.g. {"backups": {"timeout_seconds": 3600}}.
+func LoadFolderDefaults(path string) (map[string]TaskDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read folder defaults: %w", err)
+	}
+	var raw map[string]TaskDefaults
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse folder defaults %s: %w", path, err)
+	}
+	defaults := make(map[string]TaskDefaults, len(raw))
+	for folder, d := range raw {
+		if d.TimeoutSeconds < 0 || d.KillGraceSeconds < 0 {
+			return nil, fmt.Errorf("folder defaults for %q must not be negative", folder)
+		}
+		defaults[strings.Trim(folder, "/")] = d
+	}
+	return defaults, nil
+}
+
+// runLimits resolves the task's timeout and kill grace period. A value set on
+// the task wins, then the default of its nearest folder that sets one. A
+// zero timeout leaves DefaultTimeout in force.
+func (e *Engine) runLimits(t models.Task) (timeoutSeconds, killGraceSeconds int) {
+	timeoutSeconds, killGraceSeconds = t.TimeoutSeconds, t.KillGraceSeconds
+	for folder := t.Folder; folder != ""; {
+		d := e.FolderDefaults[folder]
+		if timeoutSeconds == 0 {
+			timeoutSeconds = d.TimeoutSeconds
+		}
+		if killGraceSeconds == 0 {
+			killGraceSeconds = d.KillGraceSeconds
+		}
+		i := strings.LastIndex(folder, "/")
+		if i < 0 {
+			break
+		}
+		folder = folder[:i]
+	}
+	return timeoutSeconds, killGraceSeconds
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestRunLimitsFolderDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults.json")
+	if err := os.WriteFile(path, []byte(`{"/backups/": {"timeout_seconds": 3600, "kill_grace_seconds": 30}, "backups/db": {"timeout_seconds": 600}}`), 0600); err != nil {
+		t.Fatalf("failed to write defaults: %v", err)
+	}
+	defaults, err := LoadFolderDefaults(path)
+	if err != nil {
+		t.Fatalf("LoadFolderDefaults failed: %v", err)
+	}
+	e := &Engine{FolderDefaults: defaults}
+
+	for _, tc := range []struct {
+		name                  string
+		task                  models.Task
+		wantTimeout, wantKill int
+	}{
+		{"outside any folder", models.Task{Folder: "reports"}, 0, 0},
+		{"folder default", models.Task{Folder: "backups"}, 3600, 30},
+		{"nearest folder wins, rest inherited", models.Task{Folder: "backups/db/nightly"}, 600, 30},
+		{"task value wins", models.Task{Folder: "backups", TimeoutSeconds: 60}, 60, 30},
+	} {
+		timeout, kill := e.runLimits(tc.task)
+		if timeout != tc.wantTimeout || kill != tc.wantKill {
+			t.Errorf("%s: got timeout=%d kill_grace=%d, want %d and %d", tc.name, timeout, kill, tc.wantTimeout, tc.wantKill)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"backups": {"timeout_seconds": -1}}`), 0600); err != nil {
+		t.Fatalf("failed to write defaults: %v", err)
+	}
+	if _, err := LoadFolderDefaults(path); err == nil {
+		t.Fatalf("expected negative defaults to be rejected")
+	}
+}
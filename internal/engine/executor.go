@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// Executor runs a task in-process instead of as a shell command. It is
+// chosen by the scheme of the command, e.g. builtin://cleanup, and gets the
+// task with Command set to that command line, or to the step being run for
+// a task with Steps. Run should stop when ctx is done, which happens when
+// the task's timeout expires.
+//
+// The returned result's Output is written to the task's log. A returned
+// error or a non-zero ExitCode fails the run, and the ExitCode is recorded.
+type Executor interface {
+	Run(ctx context.Context, t models.Task) (RunResult, error)
+}
+
+// CommandValidator may be implemented by an Executor to reject commands it
+// can't run, such as unknown job names, when a task is saved rather than
+// when it runs.
+type CommandValidator interface {
+	ValidateCommand(command string) error
+}
+
+// BuiltinScheme is the command scheme of the executor the engine ships with.
+const BuiltinScheme = "builtin"
+
+// RegisterExecutor makes commands with the given scheme, such as "plugin"
+// for plugin://job, run with ex instead of the shell. It replaces any
+// executor already registered for the scheme, the built-in one included.
+// Commands with a scheme resolve before env interpolation, remote scripts
+// and the command wrapper, and don't run in the sandbox.
+func (e *Engine) RegisterExecutor(scheme string, ex Executor) {
+	e.executorsMu.Lock()
+	defer e.executorsMu.Unlock()
+	if e.executors == nil {
+		e.executors = make(map[string]Executor)
+	}
+	e.executors[scheme] = ex
+}
+
+// ValidateExecutorCommand reports why command can't run, if it names an
+// executor: its scheme has no registered executor, or the executor rejects
+// it. Commands without a scheme, and script URLs, are left to the shell.
+func (e *Engine) ValidateExecutorCommand(command string) error {
+	scheme, ok := commandScheme(command)
+	if !ok || scheme == "http" || scheme == "https" {
+		return nil
+	}
+	ex, ok := e.executorFor(command)
+	if !ok {
+		return fmt.Errorf("no executor is registered for %s://", scheme)
+	}
+	if v, ok := ex.(CommandValidator); ok {
+		return v.ValidateCommand(command)
+	}
+	return nil
+}
+
+// commandScheme returns the URL scheme command starts with, if any.
+func commandScheme(command string) (string, bool) {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(command), "://")
+	if !ok || scheme == "" {
+		return "", false
+	}
+	for i, r := range scheme {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return "", false
+		}
+	}
+	return scheme, true
+}
+
+// executorFor returns the executor registered for command's scheme, if any.
+func (e *Engine) executorFor(command string) (Executor, bool) {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(command), "://")
+	if !ok || scheme == "" {
+		return nil, false
+	}
+	e.executorsMu.RLock()
+	defer e.executorsMu.RUnlock()
+	ex, ok := e.executors[scheme]
+	return ex, ok
+}
+
+// builtinExecutor runs the engine's own maintenance jobs, so they can be
+// scheduled like any task:
+//
+//	builtin://cleanup  deletes (or archives) logs past LogRetention
+//
+// A job doesn't start once ctx is done, but a started one runs to the end:
+// jobs are quick, and stopping one halfway gains nothing.
+type builtinExecutor struct {
+	e *Engine
+}
+
+// builtinJobs maps each built-in job's name to its function, which returns
+// the job's output.
+var builtinJobs = map[string]func(e *Engine) string{
+	"cleanup": func(e *Engine) string {
+		e.PurgeOldLogs()
+		return fmt.Sprintf("Purged logs older than %s\n", e.LogRetention)
+	},
+}
+
+func builtinJob(command string) string {
+	return strings.TrimPrefix(strings.TrimSpace(command), BuiltinScheme+"://")
+}
+
+func (b builtinExecutor) ValidateCommand(command string) error {
+	if job := builtinJob(command); builtinJobs[job] == nil {
+		return fmt.Errorf("unknown builtin job %q", job)
+	}
+	return nil
+}
+
+func (b builtinExecutor) Run(ctx context.Context, t models.Task) (RunResult, error) {
+	run := builtinJobs[builtinJob(t.Command)]
+	if run == nil {
+		return RunResult{ExitCode: 127}, b.ValidateCommand(t.Command)
+	}
+	if err := ctx.Err(); err != nil {
+		return RunResult{}, err
+	}
+	return RunResult{Output: run(b.e)}, nil
+}
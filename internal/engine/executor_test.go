@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// recordingExecutor remembers the commands it was asked to run.
+type recordingExecutor struct {
+	commands []string
+	fail     bool
+	exitCode int
+}
+
+func (r *recordingExecutor) Run(ctx context.Context, t models.Task) (RunResult, error) {
+	r.commands = append(r.commands, t.Command)
+	if r.fail {
+		return RunResult{Output: "went wrong\n", ExitCode: 3}, errors.New("plugin failed")
+	}
+	return RunResult{Output: "ran " + t.Command + "\n", ExitCode: r.exitCode}, nil
+}
+
+func TestRunTaskExecutor(t *testing.T) {
+	e, _ := newTestEngine(t)
+	ex := &recordingExecutor{}
+	e.RegisterExecutor("plugin", ex)
+
+	// Executor steps mix with shell ones and skip the command wrapper.
+	e.CommandWrapper = template.Must(template.New("wrapper").Parse(`echo wrapped; {{.Command}}`))
+	task := models.Task{ID: 1, Name: "mixed", Steps: []string{"plugin://first", "echo shell", "plugin://second"}}
+	result, err := e.runTask(task)
+	if err != nil {
+		t.Fatalf("expected the executor run to succeed, got %v", err)
+	}
+	if strings.Join(ex.commands, ",") != "plugin://first,plugin://second" {
+		t.Fatalf("unexpected executor commands %v", ex.commands)
+	}
+	if !strings.Contains(result.Output, "ran plugin://second") || !strings.Contains(result.Output, "wrapped\nshell") || strings.Count(result.Output, "wrapped") != 1 {
+		t.Fatalf("expected the executor's and the wrapped shell step's output, got %q", result.Output)
+	}
+
+	ex.fail = true
+	result, err = e.runTask(models.Task{ID: 2, Name: "failing", Command: "plugin://job"})
+	if err == nil || !strings.Contains(err.Error(), "plugin failed") || result.ExitCode != 3 {
+		t.Fatalf("expected the executor's failure and exit code, got %v, %+v", err, result)
+	}
+
+	// An exit code without an error still fails the run.
+	ex.fail, ex.exitCode = false, 4
+	result, err = e.runTask(models.Task{ID: 3, Name: "exit code", Command: "plugin://job"})
+	if err == nil || result.ExitCode != 4 {
+		t.Fatalf("expected exit code 4 to fail the run, got %v, %+v", err, result)
+	}
+
+	// Unregistered schemes aren't executors.
+	if _, ok := e.executorFor("other://job"); ok {
+		t.Fatalf("expected no executor for an unregistered scheme")
+	}
+}
+
+func TestValidateExecutorCommand(t *testing.T) {
+	e, _ := newTestEngine(t)
+	e.RegisterExecutor("plugin", &recordingExecutor{})
+
+	for command, valid := range map[string]bool{
+		"echo hi":                       true,
+		"curl https://example.com/x.sh": true,
+		"https://example.com/x.sh":      true,
+		"plugin://anything":             true,
+		"builtin://cleanup":             true,
+		"builtin://cleanpu":             false,
+		"plgin://job":                   false,
+	} {
+		if err := e.ValidateExecutorCommand(command); (err == nil) != valid {
+			t.Errorf("ValidateExecutorCommand(%q) = %v, want valid %v", command, err, valid)
+		}
+	}
+}
+
+func TestBuiltinCleanupExecutor(t *testing.T) {
+	e, dataDir := newTestEngine(t)
+	logsDir := filepath.Join(dataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	old := filepath.Join(logsDir, "task_9_20200101.log")
+	if err := os.WriteFile(old, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+	stale := time.Now().Add(-72 * time.Hour)
+	if err := os.Chtimes(old, stale, stale); err != nil {
+		t.Fatalf("failed to age log: %v", err)
+	}
+
+	result, err := e.runTask(models.Task{ID: 1, Name: "cleanup", Command: "builtin://cleanup"})
+	if err != nil || !strings.Contains(result.Output, "Purged logs older than 48h") {
+		t.Fatalf("expected the cleanup to succeed, got %v, %q", err, result.Output)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("expected the old log to be purged, got %v", err)
+	}
+
+	if result, err := e.runTask(models.Task{ID: 2, Name: "typo", Command: "builtin://cleanpu"}); err == nil || result.ExitCode != 127 {
+		t.Fatalf("expected an unknown builtin job to fail, got %v, %+v", err, result)
+	}
+}
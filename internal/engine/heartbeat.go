@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// HeartbeatInterval is how often the built-in heartbeat job fires.
+const HeartbeatInterval = time.Minute
+
+// StartHeartbeat schedules the built-in heartbeat job. It lives outside the
+// task table, so it is never listed, edited or removed by Reload. Each beat
+// records the time in memory and in DATA_DIR/heartbeat so a wedged scheduler
+// can be detected from outside.
+func (e *Engine) StartHeartbeat() {
+	e.heartbeatEnabled.Store(true)
+	e.scheduleHeartbeat(e.cron)
+	e.beat()
+}
+
+// scheduleHeartbeat adds the heartbeat job to c.
+func (e *Engine) scheduleHeartbeat(c *cron.Cron) {
+	_, _ = c.AddFunc("@every "+HeartbeatInterval.String(), e.beat)
+}
+
+func (e *Engine) beat() {
+	now := time.Now()
+	e.lastHeartbeat.Store(now.UnixNano())
+	path := filepath.Join(e.dataDir, "heartbeat")
+	if err := os.WriteFile(path, []byte(now.Format(time.RFC3339)+"\n"), 0644); err != nil {
+		log.Printf("Failed to write heartbeat: %v", err)
+	}
+}
+
+// LastHeartbeat returns when the heartbeat job last fired; ok is false if
+// the heartbeat is disabled.
+func (e *Engine) LastHeartbeat() (last time.Time, ok bool) {
+	if !e.heartbeatEnabled.Load() {
+		return time.Time{}, false
+	}
+	return time.Unix(0, e.lastHeartbeat.Load()), true
+}
@@ -0,0 +1,274 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// Log rotation modes select how often a task starts a new log file.
+const (
+	LogRotationDaily   = "daily"
+	LogRotationWeekly  = "weekly"
+	LogRotationMonthly = "monthly"
+)
+
+// ValidLogRotation reports whether rotation is a known mode; empty means
+// daily.
+func ValidLogRotation(rotation string) bool {
+	switch rotation {
+	case "", LogRotationDaily, LogRotationWeekly, LogRotationMonthly:
+		return true
+	}
+	return false
+}
+
+// logFileName returns the log file a run of the task starting at now writes
+// to: task_ID_20060102.log daily, task_ID_2006W01.log weekly (ISO week) or
+// task_ID_200601.log monthly.
+func logFileName(taskID int, rotation string, now time.Time) string {
+	var stamp string
+	switch rotation {
+	case LogRotationWeekly:
+		year, week := now.ISOWeek()
+		stamp = fmt.Sprintf("%04dW%02d", year, week)
+	case LogRotationMonthly:
+		stamp = now.Format("200601")
+	default:
+		stamp = now.Format("20060102")
+	}
+	return fmt.Sprintf("task_%d_%s.log", taskID, stamp)
+}
+
+// logPeriod turns a log file stamp back into a readable period:
+// 2006-01-02, 2006-W01 or 2006-01. Unknown stamps give "".
+func logPeriod(stamp string) string {
+	if day, err := time.Parse("20060102", stamp); err == nil {
+		return day.Format("2006-01-02")
+	}
+	var year, week int
+	if n, err := fmt.Sscanf(stamp, "%4dW%2d", &year, &week); err == nil && n == 2 && len(stamp) == 7 {
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	}
+	if month, err := time.Parse("200601", stamp); err == nil {
+		return month.Format("2006-01")
+	}
+	return ""
+}
+
+// LogFileInfo describes one of a task's log files.
+type LogFileInfo struct {
+	Name string `json:"name"`
+	Date string `json:"date,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// LogFiles returns the paths of every log file written for a task, oldest
+// first. The legacy task_ID.log sorts before the dated task_ID_*.log files.
+func LogFiles(dataDir string, taskID int) []string {
+	logsDir := filepath.Join(dataDir, "logs")
+
+	// Two patterns keep task_10 from matching when the id is 1.
+	legacyPath := filepath.Join(logsDir, fmt.Sprintf("task_%d.log", taskID))
+	datedPattern := filepath.Join(logsDir, fmt.Sprintf("task_%d_*.log", taskID))
+
+	matches, _ := filepath.Glob(datedPattern)
+	if _, err := os.Stat(legacyPath); err == nil {
+		matches = append([]string{legacyPath}, matches...)
+	}
+	return matches
+}
+
+// LogBytes returns the combined size of a task's log files.
+func LogBytes(dataDir string, taskID int) int64 {
+	var total int64
+	for _, path := range LogFiles(dataDir, taskID) {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// ListLogFiles describes each of a task's log files, oldest first. Date is
+// taken from the file name and is empty for the legacy undated log.
+func ListLogFiles(dataDir string, taskID int) []LogFileInfo {
+	prefix := fmt.Sprintf("task_%d_", taskID)
+	var files []LogFileInfo
+	for _, path := range LogFiles(dataDir, taskID) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(path)
+		file := LogFileInfo{
+			Name: name,
+			Size: info.Size(),
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".log")
+		file.Date = logPeriod(stamp)
+		files = append(files, file)
+	}
+	return files
+}
+
+// LogFilePath returns the path of the named log file if it belongs to the
+// task, so callers never open arbitrary paths from user input.
+func LogFilePath(dataDir string, taskID int, name string) (string, bool) {
+	for _, path := range LogFiles(dataDir, taskID) {
+		if filepath.Base(path) == name {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// LogMatch is a log line found by SearchLogs. Line counts from 1.
+type LogMatch struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// SearchLogs calls fn with every line of the task's log files, oldest first,
+// that contains query. Files are read a line at a time, so large logs are
+// never held in memory. It stops at the first error from fn.
+func SearchLogs(dataDir string, taskID int, query string, caseInsensitive bool, fn func(LogMatch) error) error {
+	if caseInsensitive {
+		query = strings.ToLower(query)
+	}
+	for _, path := range LogFiles(dataDir, taskID) {
+		if err := searchLogFile(path, query, caseInsensitive, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func searchLogFile(path, query string, caseInsensitive bool, fn func(LogMatch) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	name := filepath.Base(path)
+	for line := 1; ; line++ {
+		text, err := r.ReadString('\n')
+		if text != "" {
+			text = strings.TrimRight(text, "\r\n")
+			haystack := text
+			if caseInsensitive {
+				haystack = strings.ToLower(text)
+			}
+			if strings.Contains(haystack, query) {
+				if err := fn(LogMatch{File: name, Line: line, Text: text}); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteLogs removes every log file of a task and returns how many were
+// deleted.
+func DeleteLogs(dataDir string, taskID int) (int, error) {
+	deleted := 0
+	for _, path := range LogFiles(dataDir, taskID) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// RunLog returns the output of a single run from its log file. A run still in
+// progress is read up to the current end of the file, as is a run without a
+// recorded length: runs from before lengths were recorded have a zero
+// offset too, so they get the whole file.
+func RunLog(dataDir string, run *models.Run) ([]byte, error) {
+	// Skipped runs never wrote a log.
+	if run.LogFile == "" {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(filepath.Join(dataDir, "logs", filepath.Base(run.LogFile)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(run.LogOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if run.Status == models.RunStatusRunning || run.LogLength == 0 {
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(io.LimitReader(f, run.LogLength))
+}
+
+// timestampWriter prefixes each line written through it with the RFC3339 time
+// it was written. A partial line is held back until its newline arrives or
+// Flush is called.
+type timestampWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	partial []byte
+	now     func() time.Time
+}
+
+func (tw *timestampWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.partial = append(tw.partial, p...)
+	for {
+		i := bytes.IndexByte(tw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if err := tw.writeLine(tw.partial[:i+1]); err != nil {
+			return len(p), err
+		}
+		tw.partial = tw.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out a trailing partial line, ending it with a newline.
+func (tw *timestampWriter) Flush() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if len(tw.partial) == 0 {
+		return nil
+	}
+	line := append(tw.partial, '\n')
+	tw.partial = nil
+	return tw.writeLine(line)
+}
+
+func (tw *timestampWriter) writeLine(line []byte) error {
+	now := time.Now
+	if tw.now != nil {
+		now = tw.now
+	}
+	_, err := fmt.Fprintf(tw.w, "%s %s", now().Format(time.RFC3339), line)
+	return err
+}
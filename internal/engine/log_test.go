@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -85,3 +86,85 @@ func TestRunTaskDailyLogs(t *testing.T) {
 		t.Errorf("expected daily log file to exist at %s, but got: %v", expectedFile, err)
 	}
 }
+
+func TestLogFileNameRotation(t *testing.T) {
+	now := time.Date(2026, 2, 12, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		rotation string
+		name     string
+		period   string
+	}{
+		{"", "task_1_20260212.log", "2026-02-12"},
+		{LogRotationDaily, "task_1_20260212.log", "2026-02-12"},
+		{LogRotationWeekly, "task_1_2026W07.log", "2026-W07"},
+		{LogRotationMonthly, "task_1_202602.log", "2026-02"},
+	}
+
+	dataDir := t.TempDir()
+	logsDir := filepath.Join(dataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	for _, c := range cases {
+		name := logFileName(1, c.rotation, now)
+		if name != c.name {
+			t.Errorf("%q: expected %s, got %s", c.rotation, c.name, name)
+		}
+		if err := os.WriteFile(filepath.Join(logsDir, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+
+	// The lookup and listing understand every format.
+	periods := map[string]string{}
+	for _, f := range ListLogFiles(dataDir, 1) {
+		periods[f.Name] = f.Date
+	}
+	for _, c := range cases {
+		if periods[c.name] != c.period {
+			t.Errorf("%s: expected period %q, got %q", c.name, c.period, periods[c.name])
+		}
+	}
+}
+
+func TestTimestampWriterPrefixesLines(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2026, 2, 12, 8, 30, 0, 0, time.UTC)
+	tw := &timestampWriter{w: &buf, now: func() time.Time { return at }}
+
+	for _, chunk := range []string{"first li", "ne\nsecond\nthi", "rd"} {
+		if _, err := tw.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	want := "2026-02-12T08:30:00Z first line\n2026-02-12T08:30:00Z second\n2026-02-12T08:30:00Z third\n"
+	if buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestRunLogWithoutLength(t *testing.T) {
+	dataDir := t.TempDir()
+	logsDir := filepath.Join(dataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logsDir, "task_1_20200101.log"), []byte("first\nsecond\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	// A run recorded before log lengths were stored gets the whole file.
+	legacy := &models.Run{Status: models.RunStatusSuccess, LogFile: "task_1_20200101.log"}
+	if got, err := RunLog(dataDir, legacy); err != nil || string(got) != "first\nsecond\n" {
+		t.Fatalf("expected the whole file, got %q, %v", got, err)
+	}
+
+	recorded := &models.Run{Status: models.RunStatusSuccess, LogFile: "task_1_20200101.log", LogOffset: 6, LogLength: 7}
+	if got, err := RunLog(dataDir, recorded); err != nil || string(got) != "second\n" {
+		t.Fatalf("expected the recorded range, got %q, %v", got, err)
+	}
+}
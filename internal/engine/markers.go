@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// JSONMarkerPrefix starts every marker line written in the json format, so
+// parsers can tell markers from command output.
+const JSONMarkerPrefix = `{"opencron":`
+
+// jsonMarker is one marker line in the json format. Event is "start",
+// "finish" or "note".
+type jsonMarker struct {
+	Event   string     `json:"opencron"`
+	RunID   int        `json:"run_id,omitempty"`
+	Task    string     `json:"task,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+	Status  string     `json:"status,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// logMarkers writes the lines opencron adds to a task's log around its
+// output: where a run starts and finishes, and notes in between.
+type logMarkers struct {
+	w    io.Writer
+	json bool
+	run  *models.Run
+	task string
+}
+
+// markers returns the marker writer for a run of t logging to w. The task's
+// LogMarkers wins over the engine's.
+func (e *Engine) markers(t models.Task, run *models.Run, w io.Writer) *logMarkers {
+	format := t.LogMarkers
+	if format == "" {
+		format = e.LogMarkers
+	}
+	return &logMarkers{w: w, json: format == models.LogMarkersJSON, run: run, task: t.Name}
+}
+
+func (m *logMarkers) writeJSON(marker jsonMarker) {
+	marker.RunID = m.run.ID
+	data, _ := json.Marshal(marker)
+	fmt.Fprintf(m.w, "%s\n", data)
+}
+
+func (m *logMarkers) start(at time.Time) {
+	if m.json {
+		fmt.Fprintln(m.w)
+		m.writeJSON(jsonMarker{Event: "start", Task: m.task, Time: &at})
+		return
+	}
+	fmt.Fprintf(m.w, "\n--- Run #%d of task %s started at %s ---\n", m.run.ID, m.task, at.Format(time.RFC3339))
+}
+
+// finish marks the end of the run, failed with err or successful if nil.
+func (m *logMarkers) finish(err error) {
+	if m.json {
+		marker := jsonMarker{Event: "finish", Status: models.RunStatusSuccess}
+		if err != nil {
+			marker.Status, marker.Error = models.RunStatusFailed, err.Error()
+		}
+		m.writeJSON(marker)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(m.w, "--- Task %s failed: %v ---\n", m.task, err)
+		return
+	}
+	fmt.Fprintf(m.w, "--- Task %s finished successfully ---\n", m.task)
+}
+
+func (m *logMarkers) notef(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if m.json {
+		m.writeJSON(jsonMarker{Event: "note", Message: message})
+		return
+	}
+	fmt.Fprintf(m.w, "--- %s ---\n", message)
+}
+
+// LogRun is one run found in a log file by its markers. Status is empty
+// while the run has no finish marker.
+type LogRun struct {
+	RunID     int       `json:"run_id"`
+	StartedAt time.Time `json:"started_at"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	textStartMarker   = regexp.MustCompile(`^--- Run #(\d+) of task .* started at (\S+) ---$`)
+	textFailedMarker  = regexp.MustCompile(`^--- Task .* failed: (.*)$`)
+	textSuccessMarker = regexp.MustCompile(`^--- Task .* finished successfully ---$`)
+)
+
+// ParseLogRuns finds the runs in a log file from their start and finish
+// markers. Both marker formats are recognized, so a file written before the
+// format was changed still parses.
+func ParseLogRuns(content []byte) []LogRun {
+	runs := []LogRun{}
+	var current *LogRun
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, JSONMarkerPrefix) {
+			var marker jsonMarker
+			if json.Unmarshal([]byte(line), &marker) != nil {
+				continue
+			}
+			switch marker.Event {
+			case "start":
+				run := LogRun{RunID: marker.RunID}
+				if marker.Time != nil {
+					run.StartedAt = *marker.Time
+				}
+				runs = append(runs, run)
+				current = &runs[len(runs)-1]
+			case "finish":
+				if current != nil && current.RunID == marker.RunID {
+					current.Status, current.Error = marker.Status, marker.Error
+					current = nil
+				}
+			}
+			continue
+		}
+		if match := textStartMarker.FindStringSubmatch(line); match != nil {
+			id, _ := strconv.Atoi(match[1])
+			started, _ := time.Parse(time.RFC3339, match[2])
+			runs = append(runs, LogRun{RunID: id, StartedAt: started})
+			current = &runs[len(runs)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if match := textFailedMarker.FindStringSubmatch(line); match != nil {
+			// An error with several lines leaves the closing dashes on the
+			// last one.
+			current.Status, current.Error = models.RunStatusFailed, strings.TrimSuffix(match[1], " ---")
+			current = nil
+		} else if textSuccessMarker.MatchString(line) {
+			current.Status = models.RunStatusSuccess
+			current = nil
+		}
+	}
+	return runs
+}
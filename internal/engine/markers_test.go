@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestLogMarkersFormats(t *testing.T) {
+	e, dataDir := newTestEngine(t)
+	e.LogMarkers = models.LogMarkersJSON
+
+	ok := models.Task{Name: "ok", Command: "echo out", Enabled: true}
+	failing := models.Task{Name: "failing", Command: "exit 3", Enabled: true, LogMarkers: models.LogMarkersText}
+	for _, task := range []*models.Task{&ok, &failing} {
+		if err := e.store.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		e.runTask(*task)
+	}
+
+	read := func(task models.Task) []byte {
+		t.Helper()
+		files := LogFiles(dataDir, task.ID)
+		if len(files) != 1 {
+			t.Fatalf("expected one log file for %s, got %v", task.Name, files)
+		}
+		content, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatalf("failed to read log: %v", err)
+		}
+		return content
+	}
+
+	// The engine's format applies to tasks without their own.
+	content := read(ok)
+	if !strings.Contains(string(content), `{"opencron":"finish","run_id":`) || strings.Contains(string(content), "---") {
+		t.Fatalf("expected JSON markers, got %q", content)
+	}
+	runs := ParseLogRuns(content)
+	if len(runs) != 1 || runs[0].Status != models.RunStatusSuccess || runs[0].StartedAt.IsZero() {
+		t.Fatalf("unexpected runs from JSON markers: %+v", runs)
+	}
+
+	content = read(failing)
+	if !strings.Contains(string(content), "--- Task failing failed: exit status 3 ---") {
+		t.Fatalf("expected text markers, got %q", content)
+	}
+	runs = ParseLogRuns(content)
+	if len(runs) != 1 || runs[0].Status != models.RunStatusFailed || runs[0].Error != "exit status 3" {
+		t.Fatalf("unexpected runs from text markers: %+v", runs)
+	}
+}
+
+func TestParseLogRunsMixedAndUnfinished(t *testing.T) {
+	content := "\n--- Run #4 of task x started at 2026-02-12T10:00:00Z ---\nout\n--- Task x failed: exit status 1: first\nsecond ---\n" +
+		"\n{\"opencron\":\"start\",\"run_id\":5,\"task\":\"x\",\"time\":\"2026-02-12T11:00:00Z\"}\n{\"opencron\":\"note\",\"run_id\":5,\"message\":\"Step 1/2\"}\n"
+	runs := ParseLogRuns([]byte(content))
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", runs)
+	}
+	if runs[0].RunID != 4 || runs[0].Status != models.RunStatusFailed || runs[0].Error != "exit status 1: first" {
+		t.Fatalf("unexpected first run: %+v", runs[0])
+	}
+	if runs[1].RunID != 5 || runs[1].Status != "" || runs[1].StartedAt.Hour() != 11 {
+		t.Fatalf("expected an unfinished second run, got %+v", runs[1])
+	}
+}
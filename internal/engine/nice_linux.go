@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// startNiced starts cmd at the given niceness from its first instruction.
+// On Linux niceness belongs to a thread and is inherited by the processes it
+// starts, so cmd is started from a thread of its own that is reniced first.
+// The thread is never unlocked, so it exits with the goroutine instead of
+// running other goroutines at the wrong priority; raising its priority back
+// may not be permitted.
+func startNiced(cmd *exec.Cmd, nice int) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), nice); err != nil {
+			errc <- niceError(nice, err)
+			return
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !linux
+
+package engine
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startNiced starts cmd and sets its niceness. Niceness here belongs to the
+// whole process, so it can't be set on a thread before the fork as on
+// Linux; the command runs its first moments at normal priority. If the
+// niceness can't be set the command is killed.
+func startNiced(cmd *exec.Cmd, nice int) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, cmd.Process.Pid, nice); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return niceError(nice, err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// niceError explains why niceness couldn't be set.
+func niceError(nice int, err error) error {
+	if errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("cannot set nice %d: %w (lowering niceness needs root or CAP_SYS_NICE)", nice, err)
+	}
+	return fmt.Errorf("cannot set nice %d: %w", nice, err)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package engine
+
+import "os/exec"
+
+// startNiced starts cmd at normal priority and returns errNiceUnsupported;
+// the caller logs a warning and lets the command run.
+func startNiced(cmd *exec.Cmd, nice int) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return errNiceUnsupported
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notification is the JSON payload POSTed to a task's notify_url.
+type Notification struct {
+	TaskID              int       `json:"task_id"`
+	TaskName            string    `json:"task_name"`
+	RunID               int       `json:"run_id"`
+	Status              string    `json:"status"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	StartedAt           time.Time `json:"started_at"`
+	FinishedAt          time.Time `json:"finished_at"`
+	// AutoDisabled is set when this failure made the engine disable the task.
+	AutoDisabled bool `json:"auto_disabled,omitempty"`
+	// Test marks a sample sent by SendTestNotification.
+	Test bool `json:"test,omitempty"`
+}
+
+// testResponseBytes caps how much of a test webhook's response is returned.
+const testResponseBytes = 4096
+
+// NotificationTestResult is what a notification target answered to a test.
+type NotificationTestResult struct {
+	StatusCode int    `json:"status_code"`
+	Body       string `json:"body"`
+}
+
+// SendTestNotification POSTs a sample failure notification for t to url and
+// reports the response. t may be a zero task when testing a bare URL. An error
+// means no response was received at all.
+func SendTestNotification(url string, t models.Task) (*NotificationTestResult, error) {
+	now := time.Now()
+	n := Notification{
+		TaskID:              t.ID,
+		TaskName:            t.Name,
+		Status:              models.RunStatusFailed,
+		Error:               "This is a test notification from opencron",
+		ConsecutiveFailures: 1,
+		StartedAt:           now,
+		FinishedAt:          now,
+		Test:                true,
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, testResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationTestResult{StatusCode: resp.StatusCode, Body: string(respBody)}, nil
+}
+
+// notifyRun fires the task's webhook for the outcomes selected by NotifyOn.
+// Failures only notify once the task has failed AlertAfterFailures times in a
+// row (at least once), based on the recorded run history. A failure that
+// auto-disabled the task is always sent, regardless of the threshold and
+// cooldown. Muted tasks send nothing.
+func (e *Engine) notifyRun(t models.Task, run *models.Run, autoDisabled bool) {
+	if t.NotifyURL == "" {
+		return
+	}
+	notifyOn := t.NotifyOn
+	if notifyOn == "" {
+		notifyOn = models.NotifyOnFailure
+	}
+
+	failures := 0
+	switch run.Status {
+	case models.RunStatusSuccess:
+		if notifyOn != models.NotifyOnSuccess && notifyOn != models.NotifyOnAlways {
+			return
+		}
+	case models.RunStatusFailed:
+		if notifyOn != models.NotifyOnFailure && notifyOn != models.NotifyOnAlways {
+			return
+		}
+		var err error
+		failures, err = e.store.ConsecutiveFailures(t.ID)
+		if err != nil {
+			log.Printf("Failed to count failures for task %s (%d): %v", t.Name, t.ID, err)
+			return
+		}
+		if failures < max(t.AlertAfterFailures, 1) && !autoDisabled {
+			return
+		}
+	default:
+		return
+	}
+
+	if t.Muted {
+		log.Printf("Suppressed notification for task %s (%d) run #%d: task is muted", t.Name, t.ID, run.ID)
+		return
+	}
+	if !e.claimAlert(t) && !autoDisabled {
+		log.Printf("Suppressed notification for task %s (%d) run #%d: within %d minute alert cooldown", t.Name, t.ID, run.ID, t.AlertCooldownMinutes)
+		return
+	}
+
+	n := Notification{
+		TaskID:              t.ID,
+		TaskName:            t.Name,
+		RunID:               run.ID,
+		Status:              run.Status,
+		Error:               run.Error,
+		ConsecutiveFailures: failures,
+		AutoDisabled:        autoDisabled,
+		StartedAt:           run.StartedAt,
+		FinishedAt:          run.FinishedAt,
+	}
+	if err := sendNotification(t.NotifyURL, n); err != nil {
+		log.Printf("Failed to notify for task %s (%d): %v", t.Name, t.ID, err)
+	}
+}
+
+// claimAlert reports whether t may send a notification now, recording the
+// time if so. Tasks without AlertCooldownMinutes are never held back.
+func (e *Engine) claimAlert(t models.Task) bool {
+	e.alertMu.Lock()
+	defer e.alertMu.Unlock()
+	now := time.Now()
+	if t.AlertCooldownMinutes > 0 {
+		if last, ok := e.lastAlert[t.ID]; ok && now.Sub(last) < time.Duration(t.AlertCooldownMinutes)*time.Minute {
+			return false
+		}
+	}
+	e.lastAlert[t.ID] = now
+	return true
+}
+
+func sendNotification(url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestNotifyAfterConsecutiveFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	var received []Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	task := models.Task{ID: 1, Name: "flaky", Command: "exit 1", NotifyURL: srv.URL, AlertAfterFailures: 2}
+
+	_, _ = e.runTask(task)
+	if len(received) != 0 {
+		t.Fatalf("expected no notification after first failure, got %d", len(received))
+	}
+
+	_, _ = e.runTask(task)
+	if len(received) != 1 {
+		t.Fatalf("expected a notification after second failure, got %d", len(received))
+	}
+	if received[0].ConsecutiveFailures != 2 || received[0].Status != models.RunStatusFailed {
+		t.Fatalf("unexpected notification payload: %+v", received[0])
+	}
+
+	task.Command = "echo ok"
+	_, _ = e.runTask(task)
+	task.Command = "exit 1"
+	_, _ = e.runTask(task)
+	if len(received) != 1 {
+		t.Fatalf("expected failure count to reset after success, got %d notifications", len(received))
+	}
+}
+
+func TestNotifyOnSuccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	var received []Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	task := models.Task{ID: 1, Name: "compliance", Command: "echo ok", NotifyURL: srv.URL}
+	_, _ = e.runTask(task)
+	if len(received) != 0 {
+		t.Fatalf("expected default notify_on to skip successes, got %d notifications", len(received))
+	}
+
+	task.NotifyOn = models.NotifyOnSuccess
+	_, _ = e.runTask(task)
+	task.Command = "exit 1"
+	_, _ = e.runTask(task)
+	if len(received) != 1 || received[0].Status != models.RunStatusSuccess {
+		t.Fatalf("expected a single success notification, got %+v", received)
+	}
+
+	task.NotifyOn = models.NotifyOnAlways
+	_, _ = e.runTask(task)
+	if len(received) != 2 || received[1].Status != models.RunStatusFailed {
+		t.Fatalf("expected a failure notification with notify_on=always, got %+v", received)
+	}
+}
+
+func TestNotifyAlertCooldown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	var received []Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	task := models.Task{ID: 1, Name: "noisy", Command: "exit 1", NotifyURL: srv.URL, AlertCooldownMinutes: 10}
+	_, _ = e.runTask(task)
+	_, _ = e.runTask(task)
+	if len(received) != 1 {
+		t.Fatalf("expected the cooldown to suppress the second alert, got %d notifications", len(received))
+	}
+
+	// Once the cooldown has passed, alerts fire again.
+	e.alertMu.Lock()
+	e.lastAlert[task.ID] = time.Now().Add(-11 * time.Minute)
+	e.alertMu.Unlock()
+	_, _ = e.runTask(task)
+	if len(received) != 2 {
+		t.Fatalf("expected an alert after the cooldown, got %d notifications", len(received))
+	}
+}
+
+func TestNotifyMuted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, dataDir := newTestEngine(t)
+
+	var received []Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	task := models.Task{ID: 1, Name: "known-broken", Command: "exit 1", NotifyURL: srv.URL, NotifyOn: models.NotifyOnAlways, AlertCooldownMinutes: 10, Muted: true}
+	if _, err := e.runTask(task); err == nil {
+		t.Fatalf("expected the muted task to still run and fail")
+	}
+	if len(received) != 0 {
+		t.Fatalf("expected no notifications for a muted task, got %+v", received)
+	}
+	if len(LogFiles(dataDir, task.ID)) != 1 {
+		t.Fatalf("expected the muted run to be logged")
+	}
+
+	// Muting doesn't use up the cooldown, so unmuting alerts straight away.
+	task.Muted = false
+	_, _ = e.runTask(task)
+	if len(received) != 1 {
+		t.Fatalf("expected an alert once unmuted, got %d notifications", len(received))
+	}
+}
+
+func TestAutoDisableAfterFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	e, _ := newTestEngine(t)
+
+	var received []Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	task := models.Task{Name: "broken", Schedule: "@hourly", Command: "exit 1", Enabled: true, NotifyURL: srv.URL, AlertAfterFailures: 5, AutoDisableAfterFailures: 2}
+	if err := e.store.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	_, _ = e.runTask(task)
+	if got, _ := e.store.GetTaskByID(task.ID); !got.Enabled {
+		t.Fatalf("expected the task to stay enabled after one failure")
+	}
+	_, _ = e.runTask(task)
+	got, err := e.store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskByID failed: %v", err)
+	}
+	if got.Enabled {
+		t.Fatalf("expected the task to be disabled after two failures")
+	}
+	if len(received) != 1 || !received[0].AutoDisabled || received[0].ConsecutiveFailures != 2 {
+		t.Fatalf("expected one auto_disabled notification despite alert_after_failures, got %+v", received)
+	}
+}
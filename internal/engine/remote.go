@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+var scriptClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxScriptBytes caps the size of a fetched remote script.
+const maxScriptBytes = 1 << 20
+
+// isRemoteScript reports whether command is an http(s) URL naming a script
+// to fetch and run rather than a command line.
+func isRemoteScript(command string) bool {
+	command = strings.TrimSpace(command)
+	return (strings.HasPrefix(command, "https://") || strings.HasPrefix(command, "http://")) && !strings.ContainsAny(command, " \t\n")
+}
+
+// maxScriptRedirects caps how many redirects a script fetch follows.
+const maxScriptRedirects = 10
+
+// checkScriptURL reports why u may not be fetched for t, if it may not: its
+// host must be listed in RemoteScriptHosts, and a plain http:// URL is only
+// allowed when CommandSHA256 pins the script, since anyone on the network
+// path could otherwise substitute their own.
+func (e *Engine) checkScriptURL(t models.Task, u *url.URL) error {
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if t.CommandSHA256 == "" {
+			return fmt.Errorf("script URL %s uses http://; use https:// or pin it with command_sha256", u.Redacted())
+		}
+	default:
+		return fmt.Errorf("script URL %s must use https://", u.Redacted())
+	}
+	if !slices.Contains(e.RemoteScriptHosts, u.Host) {
+		return fmt.Errorf("script host %q is not allowed; add it to REMOTE_SCRIPT_HOSTS", u.Host)
+	}
+	return nil
+}
+
+// parseScriptURL parses rawURL and checks it with checkScriptURL.
+func (e *Engine) parseScriptURL(t models.Task, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid script URL: %w", err)
+	}
+	if err := e.checkScriptURL(t, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// remoteScriptCommand fetches the script at rawURL into DATA_DIR/scripts and
+// returns the command line that runs the local copy. The URL, and every
+// redirect followed, must pass checkScriptURL. With CommandSHA256 set, the
+// script must have that digest, and a cached copy that has it is used
+// without fetching again.
+func (e *Engine) remoteScriptCommand(t models.Task, rawURL string) (string, error) {
+	u, err := e.parseScriptURL(t, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	key := sha256.Sum256([]byte(u.String()))
+	cached := filepath.Join(e.dataDir, "scripts", hex.EncodeToString(key[:16]))
+	want := strings.ToLower(t.CommandSHA256)
+	if want != "" {
+		if data, err := os.ReadFile(cached); err == nil && sha256Hex(data) == want {
+			return commandFileCommand(cached)
+		}
+	}
+
+	client := *scriptClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxScriptRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxScriptRedirects)
+		}
+		return e.checkScriptURL(t, req.URL)
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch script: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch script: %s returned %s", u.Redacted(), resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch script: %w", err)
+	}
+	if len(data) > maxScriptBytes {
+		return "", fmt.Errorf("script %s is larger than %d bytes", u.Redacted(), maxScriptBytes)
+	}
+	if got := sha256Hex(data); want != "" && got != want {
+		return "", fmt.Errorf("script %s has SHA-256 %s, expected %s", u.Redacted(), got, want)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return "", fmt.Errorf("failed to create scripts directory: %w", err)
+	}
+	// Write to a temporary name first so a concurrent run never executes a
+	// partly written script.
+	tmp, err := os.CreateTemp(filepath.Dir(cached), "fetch-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", err
+	}
+	return commandFileCommand(cached)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestRunTaskRemoteScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	e, _ := newTestEngine(t)
+
+	script := "#!/bin/sh\necho remote-ok\n"
+	fetches := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(script))
+	}))
+	useScriptClient(t, srv.Client())
+	u, _ := url.Parse(srv.URL)
+	task := models.Task{ID: 1, Name: "remote", Command: srv.URL + "/backup.sh"}
+
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected an unlisted host to be rejected, got: %v", err)
+	}
+
+	e.RemoteScriptHosts = []string{u.Host}
+	result, err := e.runTask(task)
+	if err != nil {
+		t.Fatalf("expected the remote script to run, got: %v", err)
+	}
+	if !strings.Contains(result.Output, "remote-ok") {
+		t.Fatalf("expected the script's output, got %q", result.Output)
+	}
+
+	task.CommandSHA256 = strings.Repeat("0", 64)
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "expected "+task.CommandSHA256) {
+		t.Fatalf("expected a checksum mismatch, got: %v", err)
+	}
+
+	// A pinned script already in the cache runs without the server.
+	task.CommandSHA256 = sha256Hex([]byte(script))
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected the pinned script to run, got: %v", err)
+	}
+	srv.Close()
+	before := fetches
+	if _, err := e.runTask(task); err != nil {
+		t.Fatalf("expected the cached script to run, got: %v", err)
+	}
+	if fetches != before {
+		t.Fatalf("expected no fetch for a cached pinned script")
+	}
+}
+
+// useScriptClient fetches remote scripts with client, e.g. one trusting a
+// test server's certificate, for the rest of the test.
+func useScriptClient(t *testing.T, client *http.Client) {
+	saved := scriptClient
+	scriptClient = client
+	t.Cleanup(func() { scriptClient = saved })
+}
+
+func TestRemoteScriptChecks(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	fetches := 0
+	var allowed, other *httptest.Server
+	other = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte("echo elsewhere\n"))
+	}))
+	defer other.Close()
+	allowed = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		http.Redirect(w, r, other.URL+"/evil.sh", http.StatusFound)
+	}))
+	defer allowed.Close()
+	useScriptClient(t, allowed.Client())
+	u, _ := url.Parse(allowed.URL)
+	e.RemoteScriptHosts = []string{u.Host, "scripts.example"}
+
+	// Redirects must stay on allowed hosts.
+	task := models.Task{Name: "redirected", Command: allowed.URL + "/job.sh"}
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected the redirect to be refused, got: %v", err)
+	}
+	if fetches != 1 {
+		t.Fatalf("expected only the allowed host to be contacted, got %d fetches", fetches)
+	}
+
+	// Plain http needs a pinned digest.
+	task = models.Task{Name: "plain", Command: "http://scripts.example/job.sh"}
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "command_sha256") {
+		t.Fatalf("expected an unpinned http:// script to be refused, got: %v", err)
+	}
+
+	// A dry run reports the URL without fetching it.
+	task = models.Task{Name: "dry", Command: allowed.URL + "/job.sh"}
+	if err := e.store.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	before := fetches
+	dry, err := e.DryRunTask(task.ID)
+	if err != nil || len(dry.Commands) != 1 || dry.Commands[0] != task.Command {
+		t.Fatalf("expected the URL to be reported, got %+v, %v", dry, err)
+	}
+	if fetches != before {
+		t.Fatalf("expected a dry run not to fetch the script")
+	}
+}
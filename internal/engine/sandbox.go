@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/opencron/opencron/internal/models"
+)
+
+// sandboxRuntimes are the container runtimes looked for, in order, when
+// SandboxRuntime is not set.
+var sandboxRuntimes = []string{"docker", "podman"}
+
+// errNoSandboxRuntime is returned when a sandboxed task can't find a
+// container runtime to run in.
+var errNoSandboxRuntime = errors.New("no container runtime found for sandboxed task; install docker or podman, or set SANDBOX_RUNTIME")
+
+// sandboxWorkdir is where the run's working directory is mounted inside the
+// container.
+const sandboxWorkdir = "/work"
+
+func (e *Engine) sandboxRuntime() (string, error) {
+	if e.SandboxRuntime != "" {
+		path, err := exec.LookPath(e.SandboxRuntime)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errNoSandboxRuntime, err)
+		}
+		return path, nil
+	}
+	for _, name := range sandboxRuntimes {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errNoSandboxRuntime
+}
+
+// sandboxContainerName names the container of a run's step, counted from 1.
+// A run that failed to be recorded has no id, so its name gets a random
+// suffix instead to stay unique among concurrent runs.
+func sandboxContainerName(runID, step int) string {
+	if runID != 0 {
+		return fmt.Sprintf("opencron-run-%d-%d", runID, step)
+	}
+	b := make([]byte, 6)
+	rand.Read(b)
+	return fmt.Sprintf("opencron-run-%s-%d", hex.EncodeToString(b), step)
+}
+
+// sandboxStopSlack is how long after asking the runtime to stop a container
+// its CLI is given to exit before being killed.
+const sandboxStopSlack = 5 * time.Second
+
+// sandboxCommand returns the command that runs command with sh in a
+// throwaway container of the task's image, named name. dir, the run's own
+// directory, is mounted at /work and used as the working directory. Only
+// the variables from GlobalEnvFile and the task's EnvFile are passed in, by
+// name, so their values stay off the command line. The task's Nice applies
+// inside the container.
+//
+// Cancelling ctx stops the container itself, not just the runtime's CLI:
+// with killGraceSeconds it is asked to stop and killed once the grace
+// period is over, otherwise it is killed straight away.
+func (e *Engine) sandboxCommand(ctx context.Context, t models.Task, command, dir, name string, killGraceSeconds int) (*exec.Cmd, error) {
+	image := t.SandboxImage
+	if image == "" {
+		image = e.SandboxImage
+	}
+	if image == "" {
+		return nil, errors.New("sandboxed task has no sandbox_image and SANDBOX_IMAGE is not set")
+	}
+	if dir == "" {
+		return nil, errors.New("sandboxed task has no working directory to mount")
+	}
+	runtimePath, err := e.sandboxRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"run", "--rm", "-i", "--name", name, "-v", dir + ":" + sandboxWorkdir, "-w", sandboxWorkdir}
+	keys, err := e.sandboxEnvKeys(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		args = append(args, "-e", key)
+	}
+	args = append(args, image)
+	if t.Nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(t.Nice))
+	}
+	args = append(args, "sh", "-c", command)
+
+	cmd := exec.CommandContext(ctx, runtimePath, args...)
+	stop := []string{"kill", name}
+	cmd.WaitDelay = sandboxStopSlack
+	if killGraceSeconds > 0 {
+		stop = []string{"stop", "-t", strconv.Itoa(killGraceSeconds), name}
+		cmd.WaitDelay += time.Duration(killGraceSeconds) * time.Second
+	}
+	cmd.Cancel = func() error {
+		// The CLI exits once the container is gone; WaitDelay kills it
+		// if that takes too long.
+		stopCmd := exec.Command(runtimePath, stop...)
+		if err := stopCmd.Start(); err != nil {
+			log.Printf("Failed to stop container %s: %v", name, err)
+			return cmd.Process.Kill()
+		}
+		go stopCmd.Wait()
+		return nil
+	}
+	return cmd, nil
+}
+
+// SandboxConflict reports why t can't run sandboxed, if it can't: a
+// command_file or a remote script resolves to a path on the host, which
+// isn't mounted into the container, and an executor scheme such as
+// builtin:// runs in-process on the host.
+func (e *Engine) SandboxConflict(t models.Task) error {
+	if !t.Sandbox {
+		return nil
+	}
+	if len(t.Steps) == 0 && t.CommandFile != "" {
+		return errors.New("command_file can't be used with sandbox; the file isn't available inside the container")
+	}
+	steps := t.Steps
+	if len(steps) == 0 {
+		steps = []string{PlatformCommand(t, runtime.GOOS)}
+	}
+	for _, step := range steps {
+		if isRemoteScript(step) {
+			return errors.New("a remote script URL can't be used with sandbox; the fetched script isn't available inside the container")
+		}
+		if _, ok := e.executorFor(step); ok {
+			return fmt.Errorf("%q can't be used with sandbox; executors run on the host, not in the container", strings.TrimSpace(step))
+		}
+	}
+	return nil
+}
+
+// sandboxEnvKeys lists the variables a sandboxed task gets: those from
+// GlobalEnvFile and the task's EnvFile.
+func (e *Engine) sandboxEnvKeys(t models.Task) ([]string, error) {
+	seen := map[string]bool{}
+	e.globalEnvMu.RLock()
+	for key := range e.globalEnv {
+		seen[key] = true
+	}
+	e.globalEnvMu.RUnlock()
+	if t.EnvFile != "" {
+		vars, err := godotenv.Read(t.EnvFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load env file %s: %w", t.EnvFile, err)
+		}
+		for key := range vars {
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestRunTaskSandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	e, _ := newTestEngine(t)
+
+	// A fake runtime that prints its arguments and the passed-in variable.
+	fake := filepath.Join(t.TempDir(), "fake-runtime")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho \"$@\"\necho \"TOKEN=$TOKEN\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write runtime: %v", err)
+	}
+	envFile := filepath.Join(t.TempDir(), "task.env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=secret\n"), 0644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	e.SandboxRuntime = fake
+	e.SandboxImage = "alpine:3"
+
+	task := models.Task{ID: 1, Name: "boxed", Command: "echo hi", Sandbox: true, EnvFile: envFile}
+	result, err := e.runTask(task)
+	if err != nil {
+		t.Fatalf("expected the sandboxed run to succeed, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(result.Output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output %q", result.Output)
+	}
+	args := strings.Fields(lines[0])
+	want := []string{"run", "--rm", "-i", "--name", "opencron-run-1-1", "-v", "", "-w", "/work", "-e", "TOKEN", "alpine:3", "sh", "-c", "echo", "hi"}
+	if len(args) != len(want) || !strings.HasSuffix(args[6], ":/work") || !strings.Contains(args[6], "opencron_task_1_") {
+		t.Fatalf("unexpected runtime arguments %q", lines[0])
+	}
+	for i, arg := range want {
+		if i != 6 && args[i] != arg {
+			t.Fatalf("expected argument %d to be %q, got %q", i, arg, args[i])
+		}
+	}
+	// The value reaches the runtime through its environment, not its
+	// arguments.
+	if lines[1] != "TOKEN=secret" || strings.Contains(lines[0], "secret") {
+		t.Fatalf("expected the variable to be passed by name, got %q", result.Output)
+	}
+
+	task.SandboxImage = "debian:12"
+	if result, err = e.runTask(task); err != nil || !strings.Contains(result.Output, " debian:12 sh -c") {
+		t.Fatalf("expected the task's image to win, got %q (%v)", result.Output, err)
+	}
+
+	task.Nice = 5
+	if result, err = e.runTask(task); err != nil || !strings.Contains(result.Output, " debian:12 nice -n 5 sh -c") {
+		t.Fatalf("expected nice to apply inside the container, got %q (%v)", result.Output, err)
+	}
+	task.Nice = 0
+
+	task.CommandFile = envFile
+	task.Command = ""
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "command_file") {
+		t.Fatalf("expected command_file to be refused, got %v", err)
+	}
+	task.CommandFile = ""
+
+	// Executors run in-process on the host, so they are refused too.
+	task.Command = "builtin://cleanup"
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "builtin://cleanup") {
+		t.Fatalf("expected an executor command to be refused, got %v", err)
+	}
+	task.Command = ""
+	task.Steps = []string{"echo hi", "builtin://cleanup"}
+	if err := e.SandboxConflict(task); err == nil || !strings.Contains(err.Error(), "builtin://cleanup") {
+		t.Fatalf("expected an executor step to be refused, got %v", err)
+	}
+	task.Steps = nil
+	task.Command = "echo hi"
+
+	e.SandboxRuntime = "opencron-no-such-runtime"
+	if _, err := e.runTask(task); !errors.Is(err, errNoSandboxRuntime) {
+		t.Fatalf("expected a missing runtime error, got %v", err)
+	}
+}
+
+func TestSandboxTimeoutStopsContainer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	e, _ := newTestEngine(t)
+
+	// The fake runtime hangs like a long-running container, and records
+	// stop requests before ending it.
+	dir := t.TempDir()
+	stops := filepath.Join(dir, "stops")
+	pid := filepath.Join(dir, "pid")
+	fake := filepath.Join(dir, "fake-runtime")
+	script := "#!/bin/sh\nif [ \"$1\" = run ]; then echo $$ > " + pid + "; exec sleep 30; fi\n" +
+		"echo \"$@\" >> " + stops + "\nkill $(cat " + pid + ")\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write runtime: %v", err)
+	}
+	e.SandboxRuntime = fake
+	e.SandboxImage = "alpine:3"
+
+	task := models.Task{ID: 1, Name: "slow", Command: "sleep 30", Sandbox: true, TimeoutSeconds: 1}
+	if _, err := e.runTask(task); err == nil || !strings.Contains(err.Error(), "killed after") {
+		t.Fatalf("expected the run to time out, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(stops)
+		if strings.TrimSpace(string(data)) == "kill opencron-run-1-1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the container to be killed by name, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSandboxContainerName(t *testing.T) {
+	if name := sandboxContainerName(12, 2); name != "opencron-run-12-2" {
+		t.Fatalf("expected the run id in the name, got %q", name)
+	}
+	// Runs without an id must not share a name.
+	a, b := sandboxContainerName(0, 1), sandboxContainerName(0, 1)
+	if a == b || !strings.HasPrefix(a, "opencron-run-") || !strings.HasSuffix(a, "-1") {
+		t.Fatalf("expected distinct names for runs without an id, got %q and %q", a, b)
+	}
+}
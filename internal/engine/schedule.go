@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+// afterPrefix introduces the "@after DURATION" schedule, which fires once,
+// DURATION after the task was created.
+const afterPrefix = "@after"
+
+// businessDayPrefix introduces the "@businessday HH:MM [holidays-file]"
+// schedule, which fires once per weekday, skipping listed holidays.
+const businessDayPrefix = "@businessday"
+
+// alignedPrefix introduces the "@aligned INTERVAL [OFFSET]" schedule, which
+// fires every INTERVAL on wall-clock boundaries counted from midnight, shifted
+// by OFFSET: "@aligned 1h 5m" fires at :05 past every hour. Unlike @every,
+// the fire times do not depend on when the server started.
+const alignedPrefix = "@aligned"
+
+// cronParser accepts standard five-field specs, an optional leading seconds
+// field, month and weekday names, and descriptors such as @daily.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parses a task schedule: either one of the extended forms
+// above or a cron spec. Scheduling, validation and previews all go through
+// it, so a schedule that validates is exactly one that runs.
+// Relative forms such as @after are taken relative to now; use TaskSchedule
+// for a stored task.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	return parseSchedule(spec, time.Now(), time.Time{})
+}
+
+// TaskSpecs returns every schedule expression of the task: Schedule, if set,
+// followed by Schedules.
+func TaskSpecs(t models.Task) []string {
+	specs := make([]string, 0, 1+len(t.Schedules))
+	if t.Schedule != "" || len(t.Schedules) == 0 {
+		specs = append(specs, t.Schedule)
+	}
+	return append(specs, t.Schedules...)
+}
+
+// TaskSchedule parses the task's schedules into one that fires whenever any
+// of them does, resolving relative forms against its stored created_at and
+// last_run so they survive restarts.
+func TaskSchedule(t models.Task) (cron.Schedule, error) {
+	scheds, err := taskSchedules(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(scheds) == 1 {
+		return scheds[0], nil
+	}
+	return multiSchedule(scheds), nil
+}
+
+// taskSchedules parses each of the task's expressions on its own.
+func taskSchedules(t models.Task) ([]cron.Schedule, error) {
+	created := t.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	specs := TaskSpecs(t)
+	scheds := make([]cron.Schedule, 0, len(specs))
+	for _, spec := range specs {
+		sched, err := parseSchedule(spec, created, t.LastRun)
+		if err != nil {
+			if len(specs) > 1 {
+				return nil, fmt.Errorf("schedule %q: %w", spec, err)
+			}
+			return nil, err
+		}
+		scheds = append(scheds, sched)
+	}
+	return scheds, nil
+}
+
+// multiSchedule fires at the earliest next time of any of its schedules.
+type multiSchedule []cron.Schedule
+
+func (m multiSchedule) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, sched := range m {
+		if at := sched.Next(t); !at.IsZero() && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+func parseSchedule(spec string, created, lastRun time.Time) (cron.Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) > 0 {
+		switch fields[0] {
+		case businessDayPrefix:
+			return parseBusinessDay(fields[1:])
+		case afterPrefix:
+			return parseAfter(fields[1:], created, lastRun)
+		case alignedPrefix:
+			return parseAligned(fields[1:])
+		}
+	}
+	return cronParser.Parse(spec)
+}
+
+// afterSchedule fires once at a fixed time. If that time passed before the
+// task ever ran, e.g. while the server was down, it fires once straight away
+// instead, at catchUp: the second after the schedule was parsed. Next is
+// pure, so previews and other callers see the same fire as the scheduler.
+type afterSchedule struct {
+	at      time.Time
+	catchUp time.Time
+}
+
+func parseAfter(args []string, created, lastRun time.Time) (cron.Schedule, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected %s DURATION, e.g. %s 30m", afterPrefix, afterPrefix)
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid duration %q, expected a positive Go duration such as 30m", args[0])
+	}
+	s := &afterSchedule{at: created.Add(d)}
+	if now := time.Now(); lastRun.Before(s.at) && !s.at.After(now) {
+		s.catchUp = now.Truncate(time.Second).Add(time.Second)
+	}
+	return s, nil
+}
+
+func (s *afterSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.at) {
+		return s.at
+	}
+	if t.Before(s.catchUp) {
+		return s.catchUp
+	}
+	return time.Time{}
+}
+
+type alignedSchedule struct {
+	interval, offset time.Duration
+}
+
+func parseAligned(args []string) (cron.Schedule, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expected %s INTERVAL [OFFSET], e.g. %s 1h 5m", alignedPrefix, alignedPrefix)
+	}
+	interval, err := time.ParseDuration(args[0])
+	if err != nil || interval < time.Minute || (24*time.Hour)%interval != 0 {
+		return nil, fmt.Errorf("invalid interval %q, expected a duration of at least 1m that divides 24h evenly", args[0])
+	}
+	s := &alignedSchedule{interval: interval}
+	if len(args) == 2 {
+		s.offset, err = time.ParseDuration(args[1])
+		if err != nil || s.offset < 0 || s.offset >= interval {
+			return nil, fmt.Errorf("invalid offset %q, expected a duration from 0 up to the interval", args[1])
+		}
+	}
+	return s, nil
+}
+
+// Next returns the first boundary after t, counting from midnight in t's
+// location. On days with a DST change, boundaries after the change shift
+// with it.
+func (s *alignedSchedule) Next(t time.Time) time.Time {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight) - s.offset
+	if since < 0 {
+		return midnight.Add(s.offset)
+	}
+	return midnight.Add(s.offset + (since/s.interval+1)*s.interval)
+}
+
+type businessDaySchedule struct {
+	hour, minute int
+	holidays     map[string]bool
+}
+
+func parseBusinessDay(args []string) (cron.Schedule, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expected %s HH:MM [holidays-file]", businessDayPrefix)
+	}
+	at, err := time.Parse("15:04", args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time of day %q, expected HH:MM", args[0])
+	}
+	s := &businessDaySchedule{hour: at.Hour(), minute: at.Minute(), holidays: map[string]bool{}}
+	if len(args) == 2 {
+		if s.holidays, err = loadHolidays(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loadHolidays reads one YYYY-MM-DD date per line; blank lines and lines
+// starting with # are ignored.
+func loadHolidays(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holidays file: %w", err)
+	}
+	defer f.Close()
+
+	holidays := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", text)
+		if err != nil {
+			return nil, fmt.Errorf("holidays file %s line %d: invalid date %q", path, line, text)
+		}
+		holidays[day.Format("2006-01-02")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read holidays file: %w", err)
+	}
+	return holidays, nil
+}
+
+// Next returns the first business day at the configured time after t, in t's
+// location. It gives up after ten years of holidays and returns zero.
+func (s *businessDaySchedule) Next(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), s.hour, s.minute, 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	for i := 0; i < 3660; i++ {
+		weekday := next.Weekday()
+		if weekday != time.Saturday && weekday != time.Sunday && !s.holidays[next.Format("2006-01-02")] {
+			return next
+		}
+		next = next.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// parseTimeOfDay parses HH:MM into minutes after midnight.
+func parseTimeOfDay(value string) (int, error) {
+	at, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return at.Hour()*60 + at.Minute(), nil
+}
+
+// ValidateSkipWindow checks a task's skip window: a start and end time of day
+// as HH:MM. A start after the end wraps past midnight.
+func ValidateSkipWindow(window [2]string) error {
+	start, err := parseTimeOfDay(window[0])
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeOfDay(window[1])
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("skip window %s-%s is empty", window[0], window[1])
+	}
+	return nil
+}
+
+// inSkipWindow returns the first window containing now's time of day. Each
+// window covers its start up to, but not including, its end. Invalid windows
+// are ignored.
+func inSkipWindow(windows [][2]string, now time.Time) ([2]string, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range windows {
+		start, err := parseTimeOfDay(w[0])
+		if err != nil {
+			continue
+		}
+		end, err := parseTimeOfDay(w[1])
+		if err != nil {
+			continue
+		}
+		if start < end && minute >= start && minute < end {
+			return w, true
+		}
+		if start > end && (minute >= start || minute < end) {
+			return w, true
+		}
+	}
+	return [2]string{}, false
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestBusinessDaySchedule(t *testing.T) {
+	holidays := filepath.Join(t.TempDir(), "holidays.txt")
+	if err := os.WriteFile(holidays, []byte("# bank holiday\n2026-02-16\n"), 0644); err != nil {
+		t.Fatalf("failed to write holidays: %v", err)
+	}
+
+	// Friday 2026-02-13 after 09:30: skip the weekend and Monday's holiday.
+	from := time.Date(2026, 2, 13, 10, 0, 0, 0, time.UTC)
+	runs, err := NextRuns("@businessday 09:30 "+holidays, from, 2)
+	if err != nil {
+		t.Fatalf("NextRuns failed: %v", err)
+	}
+	want := []time.Time{
+		time.Date(2026, 2, 17, 9, 30, 0, 0, time.UTC),
+		time.Date(2026, 2, 18, 9, 30, 0, 0, time.UTC),
+	}
+	if len(runs) != len(want) || !runs[0].Equal(want[0]) || !runs[1].Equal(want[1]) {
+		t.Fatalf("expected %v, got %v", want, runs)
+	}
+
+	for _, spec := range []string{"@businessday", "@businessday 25:00", "@businessday 09:30 " + filepath.Join(t.TempDir(), "missing.txt")} {
+		if _, err := NextRuns(spec, from, 1); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"*/5 * * * *", "30 */5 * * * *", "0 9 * * MON-FRI", "@daily", "@every 90s", "@businessday 09:30"} {
+		if _, err := ParseSchedule(spec); err != nil {
+			t.Errorf("expected %q to parse, got: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "bogus", "* * *", "61 * * * *", "1 2 3 4 5 6 7"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestAfterSchedule(t *testing.T) {
+	created := time.Now().Add(-10 * time.Minute)
+
+	sched, err := TaskSchedule(models.Task{Schedule: "@after 30m", CreatedAt: created})
+	if err != nil {
+		t.Fatalf("TaskSchedule failed: %v", err)
+	}
+	want := created.Add(30 * time.Minute)
+	if next := sched.Next(time.Now()); !next.Equal(want) {
+		t.Fatalf("expected first fire at %s, got %s", want, next)
+	}
+	if next := sched.Next(want); !next.IsZero() {
+		t.Fatalf("expected no fire after the first, got %s", next)
+	}
+
+	// Overdue while the server was down: fire once immediately.
+	sched, err = TaskSchedule(models.Task{Schedule: "@after 5m", CreatedAt: created})
+	if err != nil {
+		t.Fatalf("TaskSchedule failed: %v", err)
+	}
+	now := time.Now()
+	catchUp := sched.Next(now)
+	if catchUp.Before(now) || catchUp.After(now.Add(time.Second)) {
+		t.Fatalf("expected overdue schedule to fire straight away, got %s", catchUp)
+	}
+	// Asking again, as a preview does, must not use up the catch-up fire.
+	if next := sched.Next(now); !next.Equal(catchUp) {
+		t.Fatalf("expected the same catch-up fire again, got %s", next)
+	}
+	if next := sched.Next(catchUp); !next.IsZero() {
+		t.Fatalf("expected overdue schedule to fire only once, got %s", next)
+	}
+
+	// Already ran: never fires again.
+	sched, _ = TaskSchedule(models.Task{Schedule: "@after 5m", CreatedAt: created, LastRun: created.Add(5 * time.Minute)})
+	if next := sched.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("expected completed schedule not to fire, got %s", next)
+	}
+
+	for _, spec := range []string{"@after", "@after soon", "@after -5m", "@after 5m 10m"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestAlignedSchedule(t *testing.T) {
+	sched, err := ParseSchedule("@aligned 1h 5m")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	runs := nextRuns(sched, time.Date(2026, 3, 2, 23, 4, 30, 0, time.UTC), 3)
+	want := []time.Time{
+		time.Date(2026, 3, 2, 23, 5, 0, 0, time.UTC),
+		time.Date(2026, 3, 3, 0, 5, 0, 0, time.UTC),
+		time.Date(2026, 3, 3, 1, 5, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			t.Fatalf("expected %v, got %v", want, runs)
+		}
+	}
+
+	// A fire time is never returned for itself.
+	sched, _ = ParseSchedule("@aligned 15m")
+	at := time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)
+	if next := sched.Next(at); !next.Equal(at.Add(15 * time.Minute)) {
+		t.Fatalf("expected the following boundary, got %s", next)
+	}
+
+	for _, spec := range []string{"@aligned", "@aligned 7h", "@aligned 30s", "@aligned 1h 1h", "@aligned 1h -5m", "@aligned 1h 5m 10m"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestInSkipWindow(t *testing.T) {
+	windows := [][2]string{{"01:00", "03:30"}, {"23:00", "00:15"}}
+	at := func(hhmm string) time.Time {
+		tm, err := time.Parse("15:04", hhmm)
+		if err != nil {
+			t.Fatalf("bad time %q: %v", hhmm, err)
+		}
+		return time.Date(2026, 3, 2, tm.Hour(), tm.Minute(), 0, 0, time.Local)
+	}
+	for hhmm, want := range map[string]bool{
+		"00:59": false,
+		"01:00": true,
+		"03:29": true,
+		"03:30": false,
+		"12:00": false,
+		"23:00": true,
+		"00:10": true,
+		"00:15": false,
+	} {
+		if _, got := inSkipWindow(windows, at(hhmm)); got != want {
+			t.Errorf("%s: expected skipped=%v, got %v", hhmm, want, got)
+		}
+	}
+
+	if err := ValidateSkipWindow([2]string{"9:00", "25:00"}); err == nil {
+		t.Fatalf("expected an invalid end time to be rejected")
+	}
+	if err := ValidateSkipWindow([2]string{"09:00", "09:00"}); err == nil {
+		t.Fatalf("expected an empty window to be rejected")
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	e, _ := newTestEngine(t)
+	e.SetLocation(tokyo)
+	now := e.Now()
+	if now.Location() != tokyo || e.cron.Location() != tokyo {
+		t.Fatalf("expected the engine to use Asia/Tokyo, got %s and %s", now.Location(), e.cron.Location())
+	}
+
+	// A stored time from another zone doesn't change where the schedule is
+	// evaluated.
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC).In(tokyo)
+	task := models.Task{Schedule: "0 9 * * *", LastRun: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}
+	runs, err := NextTaskRuns(task, from, 1)
+	if err != nil {
+		t.Fatalf("NextTaskRuns failed: %v", err)
+	}
+	if want := time.Date(2026, 3, 3, 9, 0, 0, 0, tokyo); !runs[0].Equal(want) {
+		t.Fatalf("expected %s, got %s", want, runs[0])
+	}
+	if !missedRun(task, from) {
+		t.Fatalf("expected the 09:00 Tokyo run on March 1 to count as missed")
+	}
+
+	// CRON_TZ in the schedule overrides the default.
+	task.Schedule = "CRON_TZ=America/New_York 0 9 * * *"
+	runs, err = NextTaskRuns(task, from, 1)
+	if err != nil {
+		t.Fatalf("NextTaskRuns failed: %v", err)
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+	if want := time.Date(2026, 3, 2, 9, 0, 0, 0, newYork); !runs[0].Equal(want) {
+		t.Fatalf("expected %s, got %s", want, runs[0])
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// sinkCloseTimeout is how long an output command may take to drain its input
+// after the task has finished before it is killed.
+const sinkCloseTimeout = 10 * time.Second
+
+// outputSink feeds a task's output to the stdin of its OutputCommand. Writes
+// never fail: once the command has stopped reading, further output is dropped
+// so the task itself keeps running.
+type outputSink struct {
+	mu     sync.Mutex
+	stdin  io.WriteCloser
+	err    error
+	wait   func() error
+	cancel context.CancelFunc
+	marks  *logMarkers
+}
+
+// startOutputSink starts command with the task's environment and working
+// directory. Its own output goes to log and notes about it to marks.
+func startOutputSink(command string, env []string, dir string, log io.Writer, marks *logMarkers) (*outputSink, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := shellCommand(ctx, command)
+	cmd.Env = env
+	cmd.Dir = dir
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.WaitDelay = time.Second
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("output command: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start output command: %w", err)
+	}
+	return &outputSink{stdin: stdin, wait: cmd.Wait, cancel: cancel, marks: marks}, nil
+}
+
+func (s *outputSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return len(p), nil
+	}
+	if _, err := s.stdin.Write(p); err != nil {
+		s.err = err
+		s.marks.notef("Output command stopped reading: %v; dropping further output", err)
+	}
+	return len(p), nil
+}
+
+// Close ends the command's input and waits for it to exit. It returns an
+// error if the input could not be closed or the command failed, which fails
+// the run; one that merely stopped reading early does not.
+func (s *outputSink) Close() error {
+	s.mu.Lock()
+	closeErr := s.stdin.Close()
+	if s.err != nil {
+		// The command is already gone; its input failing to close too is
+		// expected.
+		closeErr = nil
+	}
+	s.mu.Unlock()
+
+	timer := time.AfterFunc(sinkCloseTimeout, s.cancel)
+	defer timer.Stop()
+	defer s.cancel()
+	if err := s.wait(); err != nil {
+		s.marks.notef("Output command failed: %v", err)
+		return fmt.Errorf("output command failed: %w", err)
+	}
+	if closeErr != nil {
+		s.marks.notef("Failed to close output command input: %v", closeErr)
+		return fmt.Errorf("failed to close output command input: %w", closeErr)
+	}
+	return nil
+}
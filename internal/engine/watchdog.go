@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultWatchdogInterval is how often the scheduler watchdog checks the
+// scheduler by default.
+const DefaultWatchdogInterval = time.Minute
+
+// watchdogGrace is how far past its next run an entry may be before the
+// scheduler is considered wedged. The scheduler starts jobs in their own
+// goroutines, so even a busy one is never late by more than a moment.
+const watchdogGrace = 30 * time.Second
+
+// watchdogSnapshotTimeout bounds how long the watchdog waits for the
+// scheduler to list its entries. A wedged scheduler never answers.
+const watchdogSnapshotTimeout = 5 * time.Second
+
+// watchdogStrikes is how many checks in a row must find the scheduler
+// wedged before it is restarted. A single overdue check may be a false
+// positive: after the wall clock jumps forward or the host resumes from
+// suspend, entries look overdue until the scheduler catches up.
+const watchdogStrikes = 2
+
+// StartWatchdog checks the scheduler every interval and, if it has stopped
+// firing entries that are due, replaces it with a fresh one and reloads the
+// tasks. Call it after Start.
+func (e *Engine) StartWatchdog(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		strikes := 0
+		for range ticker.C {
+			strikes = e.checkScheduler(time.Now(), strikes)
+		}
+	}()
+}
+
+// checkScheduler runs one watchdog check, given how many checks in a row
+// have found the scheduler wedged so far, and returns the new count. It
+// restarts the scheduler once the count reaches watchdogStrikes.
+func (e *Engine) checkScheduler(now time.Time, strikes int) int {
+	reason, wedged := e.schedulerWedged(now)
+	if !wedged {
+		return 0
+	}
+	strikes++
+	if strikes < watchdogStrikes {
+		log.Printf("Scheduler watchdog: scheduler may be wedged (%s), or the clock jumped; checking again before restarting it", reason)
+		return strikes
+	}
+	log.Printf("Scheduler watchdog: scheduler appears wedged (%s); restarting it", reason)
+	e.restartScheduler()
+	log.Printf("Scheduler watchdog: scheduler restarted with %d tasks", e.Status().ScheduledTasks)
+	return 0
+}
+
+// schedulerWedged reports whether the scheduler has stopped firing, with the
+// reason if so.
+func (e *Engine) schedulerWedged(now time.Time) (string, bool) {
+	e.mu.Lock()
+	c := e.cron
+	e.mu.Unlock()
+
+	snapshot := make(chan []cron.Entry, 1)
+	go func() { snapshot <- c.Entries() }()
+	select {
+	case entries := <-snapshot:
+		if entry, ok := overdueEntry(entries, now); ok {
+			return fmt.Sprintf("entry %d was due at %s", entry.ID, entry.Next.Format(time.RFC3339)), true
+		}
+		return "", false
+	case <-time.After(watchdogSnapshotTimeout):
+		return "it did not list its entries within " + watchdogSnapshotTimeout.String(), true
+	}
+}
+
+// overdueEntry returns an entry whose next run is more than watchdogGrace
+// before now.
+func overdueEntry(entries []cron.Entry, now time.Time) (cron.Entry, bool) {
+	for _, entry := range entries {
+		if !entry.Next.IsZero() && now.Sub(entry.Next) > watchdogGrace {
+			return entry, true
+		}
+	}
+	return cron.Entry{}, false
+}
+
+// restartScheduler replaces the scheduler with a new one holding the
+// built-in jobs and every task. The new one is set up and started before it
+// is swapped in, so nothing sees a half-built scheduler. The old one is told
+// to stop in the background, since a wedged scheduler may never acknowledge
+// it.
+func (e *Engine) restartScheduler() {
+	c := cron.New(cron.WithParser(cronParser), cron.WithLocation(e.location))
+	e.scheduleLogJanitor(c)
+	if e.heartbeatEnabled.Load() {
+		e.scheduleHeartbeat(c)
+	}
+	c.Start()
+
+	e.mu.Lock()
+	old := e.cron
+	e.cron = c
+	e.entries = make(map[int][]cron.EntryID)
+	e.mu.Unlock()
+	go old.Stop()
+
+	e.Reload()
+	e.watchdogRestarts.Add(1)
+}
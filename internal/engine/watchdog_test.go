@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestSchedulerWatchdog(t *testing.T) {
+	e, _ := newTestEngine(t)
+	task := models.Task{Name: "nightly", Schedule: "0 3 * * *", Command: "echo hi", Enabled: true}
+	if err := e.store.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	e.Start()
+	t.Cleanup(func() { e.cron.Stop() })
+
+	if reason, wedged := e.schedulerWedged(time.Now()); wedged {
+		t.Fatalf("expected a healthy scheduler, got %s", reason)
+	}
+	// A scheduler that stopped firing leaves entries behind their due time.
+	e.cron.Stop()
+	if _, wedged := e.schedulerWedged(time.Now().Add(2 * time.Hour)); !wedged {
+		t.Fatalf("expected overdue entries to be reported")
+	}
+
+	// The first overdue check may be a clock jump, so only the second in a
+	// row restarts the scheduler.
+	later := time.Now().Add(2 * time.Hour)
+	if strikes := e.checkScheduler(later, 0); strikes != 1 || e.Status().WatchdogRestarts != 0 {
+		t.Fatalf("expected one strike and no restart, got %d strikes, %+v", strikes, e.Status())
+	}
+	if strikes := e.checkScheduler(later, 1); strikes != 0 {
+		t.Fatalf("expected the strikes to reset after a restart, got %d", strikes)
+	}
+	status := e.Status()
+	if status.WatchdogRestarts != 1 || status.ScheduledTasks != 1 {
+		t.Fatalf("expected one restart with the task rescheduled, got %+v", status)
+	}
+	// The new scheduler holds the log janitor and the task.
+	if entries := e.cron.Entries(); len(entries) != 2 {
+		t.Fatalf("expected 2 entries after the restart, got %d", len(entries))
+	}
+	if reason, wedged := e.schedulerWedged(time.Now()); wedged {
+		t.Fatalf("expected the new scheduler to be healthy, got %s", reason)
+	}
+}
@@ -1,15 +1,26 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/opencron/opencron/internal/engine"
 	"github.com/opencron/opencron/internal/models"
@@ -20,18 +31,386 @@ type API struct {
 	Store   *store.Store
 	Engine  *engine.Engine
 	DataDir string
+	// MaxTasks caps how many tasks may exist; zero means unlimited.
+	MaxTasks int
+	// Config is reported by GET /api/config.
+	Config Config
+	// MaxBodyBytes caps request bodies; MaxLargeBodyBytes applies instead to
+	// /mcp and task imports. Zero uses the defaults below.
+	MaxBodyBytes      int64
+	MaxLargeBodyBytes int64
+	// IdempotencyKeyTTL is how long an Idempotency-Key on POST /api/tasks is
+	// remembered. Zero uses defaultIdempotencyKeyTTL.
+	IdempotencyKeyTTL time.Duration
+	// TrustedProxies are the peers whose X-Forwarded-For and X-Real-IP
+	// headers are believed when logging the client IP.
+	TrustedProxies []netip.Prefix
+	// DevMode enables debugging endpoints that are unsafe in production,
+	// such as POST /api/scheduler/tick.
+	DevMode bool
 }
 
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// defaultTickWindow is how far ahead POST /api/scheduler/tick looks for due
+// tasks when no window is given.
+const defaultTickWindow = time.Minute
+
+// idempotencySince returns the oldest creation time of an idempotency key
+// that is still honoured.
+func (api *API) idempotencySince() time.Time {
+	ttl := api.IdempotencyKeyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+	return time.Now().Add(-ttl)
+}
+
+// Default request body limits.
+const (
+	defaultMaxBodyBytes      = 1 << 20
+	defaultMaxLargeBodyBytes = 10 << 20
+)
+
+// bodyLimit returns the request body size limit for path.
+func (api *API) bodyLimit(path string) int64 {
+	if path == "/mcp" || path == "/api/tasks/import" {
+		if api.MaxLargeBodyBytes > 0 {
+			return api.MaxLargeBodyBytes
+		}
+		return defaultMaxLargeBodyBytes
+	}
+	if api.MaxBodyBytes > 0 {
+		return api.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// writeDecodeError reports a request body that failed to decode, using 413
+// when it exceeded the size limit.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body too large (limit %d bytes)", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// Config is the effective server configuration as resolved from the
+// environment at startup. Secrets are reported only as whether they are set.
+type Config struct {
+	Port               string `json:"port"`
+	DataDir            string `json:"data_dir"`
+	LogRetentionHours  int    `json:"log_retention_hours"`
+	LogRotation        string `json:"log_rotation"`
+	LogMarkers         string `json:"log_markers"`
+	DefaultTaskTimeout string `json:"default_task_timeout"`
+	CommandWrapper     string `json:"command_wrapper"`
+	MaxTasks           int    `json:"max_tasks"`
+	HeartbeatEnabled   bool   `json:"heartbeat_enabled"`
+	APIKeySet          bool   `json:"api_key_set"`
+	MCPEnabled         bool   `json:"mcp_enabled"`
+	Environment        string `json:"environment"`
+	DefaultTimezone    string `json:"default_timezone"`
+	TLSEnabled         bool   `json:"tls_enabled"`
+	DevMode            bool   `json:"dev_mode"`
+}
+
+// errTaskQuota is returned when creating a task would exceed MaxTasks.
+var errTaskQuota = errors.New("task quota reached")
+
+// taskDetail is the single-task GET response, adding computed fields to the
+// stored task.
+type taskDetail struct {
+	models.Task
+	LogBytes int64 `json:"log_bytes"`
+	// SuccessRate is over the last RunCount finished runs, at most
+	// successRateRuns.
+	SuccessRate float64 `json:"success_rate"`
+	RunCount    int     `json:"run_count"`
+}
+
+// successRateRuns is how many recent runs success_rate is computed over.
+const successRateRuns = 20
+
+// commandValidation is the response of POST /api/tasks/{id}/validate-command.
+type commandValidation struct {
+	Valid    bool          `json:"valid"`
+	Commands []commandArgv `json:"commands"`
+}
+
+// commandArgv is one resolved command and how it splits into arguments.
+type commandArgv struct {
+	Command string   `json:"command"`
+	Argv    []string `json:"argv,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// defaultLogSearchLimit caps the matches GET /api/tasks/{id}/logs/search
+// returns unless ?limit is given.
+const defaultLogSearchLimit = 1000
+
+// logSearchFlushEvery is how many matches are written between flushes.
+const logSearchFlushEvery = 100
+
+// errLogSearchLimit stops a log search once enough matches were sent.
+var errLogSearchLimit = errors.New("log search limit reached")
+
+// logFileContent is one file in the JSON form of the logs endpoint.
+type logFileContent struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// Runs are found from the markers in Content.
+	Runs []engine.LogRun `json:"runs"`
+}
+
+// prettyJSONLines indents every line of content that holds a JSON object or
+// array, leaving run markers and other text as they are.
+func prettyJSONLines(content []byte) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var out bytes.Buffer
+	for _, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && !bytes.HasPrefix(trimmed, []byte(engine.JSONMarkerPrefix)) {
+			var indented bytes.Buffer
+			if json.Indent(&indented, trimmed, "", "  ") == nil {
+				out.Write(indented.Bytes())
+				if bytes.HasSuffix(line, []byte("\n")) {
+					out.WriteByte('\n')
+				}
+				continue
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+type upcomingTask struct {
+	models.Task
+	NextRun time.Time `json:"next_run"`
+}
+
+// nextRun returns when an enabled task next fires after now, skipping fires
+// during a snooze or before its start_after. ok is false for disabled or
+// unschedulable tasks.
+func nextRun(t models.Task, now time.Time) (next time.Time, ok bool) {
+	if !t.Enabled {
+		return time.Time{}, false
+	}
+	from := now
+	if t.PausedUntil.After(from) {
+		from = t.PausedUntil.In(now.Location())
+	}
+	if t.StartAfter.After(from) {
+		from = t.StartAfter.In(now.Location())
+	}
+	runs, err := engine.NextTaskRuns(t, from, 1)
+	if err != nil || len(runs) == 0 {
+		return time.Time{}, false
+	}
+	return runs[0], true
+}
+
+// sortTasksByNextRun orders tasks soonest first; tasks that will not fire
+// keep their relative order at the end.
+func sortTasksByNextRun(tasks []models.Task, now time.Time) {
+	next := make(map[int]time.Time, len(tasks))
+	for _, t := range tasks {
+		if at, ok := nextRun(t, now); ok {
+			next[t.ID] = at
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, aok := next[tasks[i].ID]
+		b, bok := next[tasks[j].ID]
+		if aok != bok {
+			return aok
+		}
+		return aok && a.Before(b)
+	})
+}
+
+// upcomingTasks returns the enabled tasks that next fire within the window
+// after now, soonest first. Fires during a snooze are skipped.
+func upcomingTasks(tasks []models.Task, now time.Time, within time.Duration) []upcomingTask {
+	upcoming := []upcomingTask{}
+	for _, t := range tasks {
+		next, ok := nextRun(t, now)
+		if !ok || next.After(now.Add(within)) {
+			continue
+		}
+		upcoming = append(upcoming, upcomingTask{Task: t, NextRun: next})
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].NextRun.Before(upcoming[j].NextRun)
+	})
+	return upcoming
+}
+
+// mcpProtocolVersions are the MCP protocol revisions this server speaks,
+// oldest first.
+var mcpProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// negotiateProtocolVersion picks the MCP revision to answer initialize with.
+// A supported request is echoed back; a newer, unknown revision gets our
+// latest so the client can decide whether to continue. Requests that are not
+// revision dates, or predate the oldest supported one, are refused. Clients
+// that send none get the oldest, as before negotiation existed.
+func negotiateProtocolVersion(requested string) (string, error) {
+	if requested == "" {
+		return mcpProtocolVersions[0], nil
+	}
+	if slices.Contains(mcpProtocolVersions, requested) {
+		return requested, nil
+	}
+	if _, err := time.Parse("2006-01-02", requested); err != nil {
+		return "", fmt.Errorf("invalid protocol version %q", requested)
+	}
+	// Revisions are dates, so they order lexically.
+	if requested < mcpProtocolVersions[0] {
+		return "", fmt.Errorf("unsupported protocol version %q", requested)
+	}
+	return mcpProtocolVersions[len(mcpProtocolVersions)-1], nil
+}
+
+// runWaitTimeout bounds how long POST /api/tasks/{id}/run?wait=true holds
+// the response open.
+const runWaitTimeout = 5 * time.Minute
+
+// mcpRunWaitTimeout bounds how long MCP run_task with wait:true holds the
+// response open.
+const mcpRunWaitTimeout = 30 * time.Second
+
+// taskImportRequest is the body of POST /api/tasks/import.
+type taskImportRequest struct {
+	Tasks       []models.Task `json:"tasks"`
+	PreserveIDs bool          `json:"preserve_ids"`
+}
+
+// bulkEnableRequest is the body of POST /api/tasks/bulk-enable and
+// bulk-disable. At least one of folder or ids is required.
+type bulkEnableRequest struct {
+	Folder string `json:"folder"`
+	IDs    []int  `json:"ids"`
+}
+
+// duplicateCheckRequest is the body of POST /api/tasks/duplicate-check.
+type duplicateCheckRequest struct {
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+	Schedule string `json:"schedule"`
+}
+
+// runRequest is the optional body of POST /api/tasks/{id}/run.
+type runRequest struct {
+	// DedupKey makes a repeat of the request within RUN_DEDUP_WINDOW return
+	// the first run instead of starting another.
+	DedupKey string `json:"dedup_key"`
+}
+
+// previewRunCount is how many upcoming fire times the preview endpoint returns.
+const previewRunCount = 5
+
+// Default and maximum count for GET /api/tasks/{id}/schedule.
+const (
+	defaultScheduleCount = 10
+	maxScheduleCount     = 500
+)
+
 type taskUpdateRequest struct {
-	Name     *string `json:"name"`
-	Schedule *string `json:"schedule"`
-	Command  *string `json:"command"`
-	Enabled  *bool   `json:"enabled"`
-	OneShot  *bool   `json:"one_shot"`
+	Name                     *string          `json:"name"`
+	Schedule                 *string          `json:"schedule"`
+	Command                  *string          `json:"command"`
+	Enabled                  *bool            `json:"enabled"`
+	OneShot                  *bool            `json:"one_shot"`
+	ExtraPath                *[]string        `json:"extra_path"`
+	NotifyURL                *string          `json:"notify_url"`
+	AlertAfterFailures       *int             `json:"alert_after_failures"`
+	FreshWorkdir             *bool            `json:"fresh_workdir"`
+	KeepWorkdirOnFailure     *bool            `json:"keep_workdir_on_failure"`
+	NotifyOn                 *string          `json:"notify_on"`
+	Folder                   *string          `json:"folder"`
+	Steps                    *[]string        `json:"steps"`
+	ContinueOnError          *bool            `json:"continue_on_error"`
+	EnvFile                  *string          `json:"env_file"`
+	SortOrder                *int             `json:"sort_order"`
+	MaxInstances             *int             `json:"max_instances"`
+	ExpandEnv                *bool            `json:"expand_env"`
+	MissedRunPolicy          *string          `json:"missed_run_policy"`
+	SuccessExitCodes         *[]int           `json:"success_exit_codes"`
+	AlertCooldownMinutes     *int             `json:"alert_cooldown_minutes"`
+	OutputCommand            *string          `json:"output_command"`
+	OutputCommandOnly        *bool            `json:"output_command_only"`
+	Environments             *[]string        `json:"environments"`
+	SkipWindows              *[][2]string     `json:"skip_windows"`
+	TimestampLines           *bool            `json:"timestamp_lines"`
+	StartAfter               *time.Time       `json:"start_after"`
+	RunCondition             *string          `json:"run_condition"`
+	Nice                     *int             `json:"nice"`
+	Batch                    *string          `json:"batch"`
+	CommandFile              *string          `json:"command_file"`
+	AutoDisableAfterFailures *int             `json:"auto_disable_after_failures"`
+	Metadata                 *json.RawMessage `json:"metadata"`
+	TimeoutSeconds           *int             `json:"timeout_seconds"`
+	KillGraceSeconds         *int             `json:"kill_grace_seconds"`
+	CommandSHA256            *string          `json:"command_sha256"`
+	OutputFormat             *string          `json:"output_format"`
+	LogMarkers               *string          `json:"log_markers"`
+	Sandbox                  *bool            `json:"sandbox"`
+	SandboxImage             *string          `json:"sandbox_image"`
+	Muted                    *bool            `json:"muted"`
+	Schedules                *[]string        `json:"schedules"`
+	CommandWindows           *string          `json:"command_windows"`
+	CommandUnix              *string          `json:"command_unix"`
 }
 
 func (u taskUpdateRequest) isEmpty() bool {
-	return u.Name == nil && u.Schedule == nil && u.Command == nil && u.Enabled == nil && u.OneShot == nil
+	return u.Name == nil &&
+		u.Schedule == nil &&
+		u.Command == nil &&
+		u.Enabled == nil &&
+		u.OneShot == nil &&
+		u.ExtraPath == nil &&
+		u.NotifyURL == nil &&
+		u.AlertAfterFailures == nil &&
+		u.FreshWorkdir == nil &&
+		u.KeepWorkdirOnFailure == nil &&
+		u.NotifyOn == nil &&
+		u.Folder == nil &&
+		u.Steps == nil &&
+		u.ContinueOnError == nil &&
+		u.EnvFile == nil &&
+		u.SortOrder == nil &&
+		u.MaxInstances == nil &&
+		u.ExpandEnv == nil &&
+		u.MissedRunPolicy == nil &&
+		u.SuccessExitCodes == nil &&
+		u.AlertCooldownMinutes == nil &&
+		u.OutputCommand == nil &&
+		u.OutputCommandOnly == nil &&
+		u.Environments == nil &&
+		u.SkipWindows == nil &&
+		u.TimestampLines == nil &&
+		u.StartAfter == nil &&
+		u.RunCondition == nil &&
+		u.Nice == nil &&
+		u.Batch == nil &&
+		u.CommandFile == nil &&
+		u.AutoDisableAfterFailures == nil &&
+		u.Metadata == nil &&
+		u.TimeoutSeconds == nil &&
+		u.KillGraceSeconds == nil &&
+		u.CommandSHA256 == nil &&
+		u.OutputFormat == nil &&
+		u.LogMarkers == nil &&
+		u.Sandbox == nil &&
+		u.SandboxImage == nil &&
+		u.Muted == nil &&
+		u.Schedules == nil &&
+		u.CommandWindows == nil &&
+		u.CommandUnix == nil
 }
 
 func applyTaskUpdate(t *models.Task, u taskUpdateRequest) {
@@ -50,172 +429,770 @@ func applyTaskUpdate(t *models.Task, u taskUpdateRequest) {
 	if u.OneShot != nil {
 		t.OneShot = *u.OneShot
 	}
+	if u.ExtraPath != nil {
+		t.ExtraPath = *u.ExtraPath
+	}
+	if u.NotifyURL != nil {
+		t.NotifyURL = *u.NotifyURL
+	}
+	if u.AlertAfterFailures != nil {
+		t.AlertAfterFailures = *u.AlertAfterFailures
+	}
+	if u.FreshWorkdir != nil {
+		t.FreshWorkdir = *u.FreshWorkdir
+	}
+	if u.KeepWorkdirOnFailure != nil {
+		t.KeepWorkdirOnFailure = *u.KeepWorkdirOnFailure
+	}
+	if u.NotifyOn != nil {
+		t.NotifyOn = *u.NotifyOn
+	}
+	if u.Folder != nil {
+		t.Folder = normalizeFolder(*u.Folder)
+	}
+	if u.Steps != nil {
+		t.Steps = *u.Steps
+	}
+	if u.ContinueOnError != nil {
+		t.ContinueOnError = *u.ContinueOnError
+	}
+	if u.EnvFile != nil {
+		t.EnvFile = *u.EnvFile
+	}
+	if u.SortOrder != nil {
+		t.SortOrder = *u.SortOrder
+	}
+	if u.MaxInstances != nil {
+		t.MaxInstances = *u.MaxInstances
+	}
+	if u.ExpandEnv != nil {
+		t.ExpandEnv = *u.ExpandEnv
+	}
+	if u.MissedRunPolicy != nil {
+		t.MissedRunPolicy = *u.MissedRunPolicy
+	}
+	if u.SuccessExitCodes != nil {
+		t.SuccessExitCodes = *u.SuccessExitCodes
+	}
+	if u.AlertCooldownMinutes != nil {
+		t.AlertCooldownMinutes = *u.AlertCooldownMinutes
+	}
+	if u.OutputCommand != nil {
+		t.OutputCommand = *u.OutputCommand
+	}
+	if u.OutputCommandOnly != nil {
+		t.OutputCommandOnly = *u.OutputCommandOnly
+	}
+	if u.Environments != nil {
+		t.Environments = *u.Environments
+	}
+	if u.SkipWindows != nil {
+		t.SkipWindows = *u.SkipWindows
+	}
+	if u.TimestampLines != nil {
+		t.TimestampLines = *u.TimestampLines
+	}
+	if u.StartAfter != nil {
+		t.StartAfter = *u.StartAfter
+	}
+	if u.RunCondition != nil {
+		t.RunCondition = *u.RunCondition
+	}
+	if u.Nice != nil {
+		t.Nice = *u.Nice
+	}
+	if u.Batch != nil {
+		t.Batch = *u.Batch
+	}
+	if u.CommandFile != nil {
+		t.CommandFile = *u.CommandFile
+	}
+	if u.AutoDisableAfterFailures != nil {
+		t.AutoDisableAfterFailures = *u.AutoDisableAfterFailures
+	}
+	if u.Metadata != nil {
+		t.Metadata = *u.Metadata
+	}
+	if u.TimeoutSeconds != nil {
+		t.TimeoutSeconds = *u.TimeoutSeconds
+	}
+	if u.KillGraceSeconds != nil {
+		t.KillGraceSeconds = *u.KillGraceSeconds
+	}
+	if u.CommandSHA256 != nil {
+		t.CommandSHA256 = *u.CommandSHA256
+	}
+	if u.OutputFormat != nil {
+		t.OutputFormat = *u.OutputFormat
+	}
+	if u.LogMarkers != nil {
+		t.LogMarkers = *u.LogMarkers
+	}
+	if u.Sandbox != nil {
+		t.Sandbox = *u.Sandbox
+	}
+	if u.SandboxImage != nil {
+		t.SandboxImage = *u.SandboxImage
+	}
+	if u.Muted != nil {
+		t.Muted = *u.Muted
+	}
+	if u.Schedules != nil {
+		t.Schedules = *u.Schedules
+	}
+	if u.CommandWindows != nil {
+		t.CommandWindows = *u.CommandWindows
+	}
+	if u.CommandUnix != nil {
+		t.CommandUnix = *u.CommandUnix
+	}
 }
 
-func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/mcp" {
-		apiKey := os.Getenv("API_KEY")
-		if apiKey != "" {
-			if r.Header.Get("X-API-Key") != apiKey {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+// platformCommandField names the task field that overrides command on goos.
+func platformCommandField(goos string) string {
+	if goos == "windows" {
+		return "command_windows"
+	}
+	return "command_unix"
+}
+
+// taskValidationErrors returns every problem that would stop t from being
+// saved. Disabled tasks may be saved without a command as placeholders, but
+// enabling them requires one.
+func (api *API) taskValidationErrors(t *models.Task) []string {
+	errs := []string{}
+	if strings.TrimSpace(t.Name) == "" {
+		errs = append(errs, "name is required")
+	}
+	// An empty schedule is allowed when schedules lists the expressions.
+	if t.Schedule != "" || len(t.Schedules) == 0 {
+		if _, err := engine.NextRuns(t.Schedule, time.Now(), 1); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid schedule %q: %v", t.Schedule, err))
+		}
+	}
+	for i, spec := range t.Schedules {
+		if _, err := engine.NextRuns(spec, time.Now(), 1); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid schedules[%d] %q: %v", i, spec, err))
+		}
+	}
+	if len(t.Steps) > 0 {
+		for i, step := range t.Steps {
+			if strings.TrimSpace(step) == "" {
+				errs = append(errs, fmt.Sprintf("step %d must not be empty", i+1))
 			}
 		}
+	} else if t.CommandFile != "" {
+		// A relative path would resolve against the server's working
+		// directory, not the caller's.
+		if !filepath.IsAbs(t.CommandFile) {
+			errs = append(errs, "command_file must be an absolute path")
+		} else if info, err := os.Stat(t.CommandFile); err != nil {
+			errs = append(errs, fmt.Sprintf("command_file: %v", err))
+		} else if info.IsDir() {
+			errs = append(errs, fmt.Sprintf("command_file %s is a directory", t.CommandFile))
+		}
+	} else if t.Enabled && strings.TrimSpace(engine.PlatformCommand(*t, runtime.GOOS)) == "" {
+		// A task meant for another OS may be saved, but only disabled: it
+		// would fail every run here.
+		errs = append(errs, fmt.Sprintf("an enabled task needs a command that runs on %s: set command or %s", runtime.GOOS, platformCommandField(runtime.GOOS)))
 	}
-
-	if strings.HasPrefix(r.URL.Path, "/api/tasks") {
-		api.handleTasks(w, r)
-		return
+	for _, command := range append([]string{t.Command, t.CommandWindows, t.CommandUnix}, t.Steps...) {
+		if err := api.Engine.ValidateExecutorCommand(command); err != nil {
+			errs = append(errs, err.Error())
+		}
 	}
-	if r.URL.Path == "/mcp" {
-		api.handleMCP(w, r)
-		return
+	if err := api.Engine.SandboxConflict(*t); err != nil {
+		errs = append(errs, err.Error())
 	}
-	// Serve static files for everything else
-	fs := http.FileServer(http.Dir("./static"))
-	fs.ServeHTTP(w, r)
+	if t.AlertAfterFailures < 0 {
+		errs = append(errs, "alert_after_failures must not be negative")
+	}
+	if t.Nice < -20 || t.Nice > 19 {
+		errs = append(errs, "nice must be between -20 and 19")
+	}
+	if t.AlertCooldownMinutes < 0 {
+		errs = append(errs, "alert_cooldown_minutes must not be negative")
+	}
+	if t.CommandSHA256 != "" {
+		if sum, err := hex.DecodeString(t.CommandSHA256); err != nil || len(sum) != sha256.Size {
+			errs = append(errs, "command_sha256 must be a hex-encoded SHA-256 digest")
+		}
+	}
+	if t.TimeoutSeconds < 0 {
+		errs = append(errs, "timeout_seconds must not be negative")
+	}
+	if t.KillGraceSeconds < 0 {
+		errs = append(errs, "kill_grace_seconds must not be negative")
+	}
+	if t.AutoDisableAfterFailures < 0 {
+		errs = append(errs, "auto_disable_after_failures must not be negative")
+	}
+	if len(t.Metadata) > 0 && !json.Valid(t.Metadata) {
+		errs = append(errs, "metadata must be valid JSON")
+	}
+	for _, w := range t.SkipWindows {
+		if err := engine.ValidateSkipWindow(w); err != nil {
+			errs = append(errs, fmt.Sprintf("skip_windows: %v", err))
+		}
+	}
+	switch t.NotifyOn {
+	case "", models.NotifyOnFailure, models.NotifyOnSuccess, models.NotifyOnAlways:
+	default:
+		errs = append(errs, fmt.Sprintf("notify_on must be one of %q, %q or %q", models.NotifyOnFailure, models.NotifyOnSuccess, models.NotifyOnAlways))
+	}
+	switch t.RunCondition {
+	case "", models.RunConditionAlways, models.RunConditionOnPrevSuccess, models.RunConditionOnPrevFailure:
+	default:
+		errs = append(errs, fmt.Sprintf("run_condition must be one of %q, %q or %q", models.RunConditionAlways, models.RunConditionOnPrevSuccess, models.RunConditionOnPrevFailure))
+	}
+	switch t.MissedRunPolicy {
+	case "", models.MissedRunSkip, models.MissedRunRunOnce:
+	default:
+		errs = append(errs, fmt.Sprintf("missed_run_policy must be %q or %q", models.MissedRunSkip, models.MissedRunRunOnce))
+	}
+	switch t.OutputFormat {
+	case "", models.OutputFormatText, models.OutputFormatJSON, models.OutputFormatANSI:
+	default:
+		errs = append(errs, fmt.Sprintf("output_format must be one of %q, %q or %q", models.OutputFormatText, models.OutputFormatJSON, models.OutputFormatANSI))
+	}
+	switch t.LogMarkers {
+	case "", models.LogMarkersText, models.LogMarkersJSON:
+	default:
+		errs = append(errs, fmt.Sprintf("log_markers must be %q or %q", models.LogMarkersText, models.LogMarkersJSON))
+	}
+	return errs
 }
 
-func (api *API) handleMCP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+func (api *API) validateTask(t *models.Task) error {
+	if errs := api.taskValidationErrors(t); len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
+	return nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
+// deleteTask deletes the task unless it is locked and force is false.
+func (api *API) deleteTask(id int, force bool) error {
+	if err := api.Store.DeleteTask(id, force); errors.Is(err, store.ErrTaskLocked) {
+		return fmt.Errorf("%w: task %d; unlock it or pass force", err, id)
+	} else if err != nil {
+		return err
+	}
+	api.Engine.Reload()
+	return nil
+}
 
-	var req struct {
-		JSONRPC string                 `json:"jsonrpc"`
-		ID      interface{}            `json:"id"`
-		Method  string                 `json:"method"`
-		Params  map[string]interface{} `json:"params"`
+// checkTaskQuota reports whether another task may be created. Updates are not
+// checked, so existing tasks stay editable at the cap.
+func (api *API) checkTaskQuota() error {
+	if api.MaxTasks <= 0 {
+		return nil
+	}
+	n, err := api.Store.CountTasks()
+	if err != nil {
+		return err
 	}
+	if n >= api.MaxTasks {
+		return fmt.Errorf("%w: %d of %d tasks in use", errTaskQuota, n, api.MaxTasks)
+	}
+	return nil
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
-		return
+// redactTriggerTokens hides trigger tokens from list responses; they are only
+// exposed when fetching or creating a single task.
+func redactTriggerTokens(tasks []models.Task) {
+	for i := range tasks {
+		tasks[i].TriggerToken = ""
 	}
+}
 
-	sendResponse := func(result interface{}) {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      req.ID,
-			"result":  result,
-		})
+// filterBrokenTasks keeps only tasks the engine failed to schedule.
+func filterBrokenTasks(tasks []models.Task) []models.Task {
+	broken := []models.Task{}
+	for _, t := range tasks {
+		if !t.LastScheduleOK {
+			broken = append(broken, t)
+		}
 	}
+	return broken
+}
 
-	switch req.Method {
-	case "initialize":
-		sendResponse(map[string]interface{}{
-			"protocolVersion": "2024-11-05",
-			"capabilities": map[string]interface{}{
-				"tools": map[string]interface{}{},
-			},
-			"serverInfo": map[string]string{"name": "opencron", "version": "1.0.0"},
-		})
+// apiKeyLabelKey is the request context key holding the label of the API key
+// that authenticated the request.
+type apiKeyLabelKey struct{}
 
-	case "notifications/initialized":
-		w.WriteHeader(http.StatusNoContent)
+// mcpCreator is recorded as created_by for tasks created over MCP, and as
+// modified_by for tasks updated over it.
+const mcpCreator = "mcp"
 
-	case "tools/list":
-		tools := []map[string]interface{}{
-			{
-				"name":        "list_tasks",
-				"description": "List all scheduled cron tasks",
-				"inputSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
-			},
-			{
-				"name":        "create_task",
-				"description": "Create a new cron task",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"name":     map[string]interface{}{"type": "string"},
-						"schedule": map[string]interface{}{"type": "string", "description": "Standard cron expression (e.g. * * * * *)"},
-						"command":  map[string]interface{}{"type": "string"},
-						"enabled":  map[string]interface{}{"type": "boolean"},
-						"one_shot": map[string]interface{}{"type": "boolean"},
-					},
-					"required": []string{"name", "schedule", "command"},
-				},
-			},
-			{
-				"name":        "update_task",
-				"description": "Update a cron task by ID. Supports partial updates, including command changes.",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"id":       map[string]interface{}{"type": "integer"},
-						"name":     map[string]interface{}{"type": "string"},
-						"schedule": map[string]interface{}{"type": "string", "description": "Standard cron expression (e.g. * * * * *)"},
-						"command":  map[string]interface{}{"type": "string"},
-						"enabled":  map[string]interface{}{"type": "boolean"},
-						"one_shot": map[string]interface{}{"type": "boolean"},
-					},
-					"required": []string{"id"},
-				},
-			},
-			{
-				"name":        "delete_task",
-				"description": "Delete a cron task by ID",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"id": map[string]interface{}{"type": "integer"},
-					},
-					"required": []string{"id"},
-				},
-			},
-			{
-				"name":        "run_task",
-				"description": "Run a task immediately by ID",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"id": map[string]interface{}{"type": "integer"},
-					},
-					"required": []string{"id"},
-				},
-			},
+// apiKeyLabel checks key against API_KEY (labelled "default") and the
+// comma-separated label=key pairs in API_KEYS. With neither set, every
+// request is allowed with an empty label.
+func apiKeyLabel(key string) (label string, ok bool) {
+	single := os.Getenv("API_KEY")
+	multi := os.Getenv("API_KEYS")
+	if single == "" && multi == "" {
+		return "", true
+	}
+	if key == "" {
+		return "", false
+	}
+	if single != "" && key == single {
+		return "default", true
+	}
+	for _, pair := range strings.Split(multi, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && value != "" && key == value {
+			return name, true
 		}
-		sendResponse(map[string]interface{}{"tools": tools})
+	}
+	return "", false
+}
 
-	case "tools/call":
-		toolName := req.Params["name"].(string)
-		args := req.Params["arguments"].(map[string]interface{})
+// requestCreator is the created_by value for tasks created by r.
+func requestCreator(r *http.Request) string {
+	label, _ := r.Context().Value(apiKeyLabelKey{}).(string)
+	return label
+}
 
-		var content []map[string]interface{}
-		var err error
+// maintenanceRetryAfter is the Retry-After, in seconds, sent while in
+// maintenance mode.
+const maintenanceRetryAfter = 60
 
-		switch toolName {
-		case "list_tasks":
-			tasks, e := api.Store.GetTasks()
-			if e == nil {
+// refuseInMaintenance responds that changes are disabled in maintenance mode.
+func refuseInMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+	http.Error(w, "Service is in maintenance mode; changes are temporarily disabled", http.StatusServiceUnavailable)
+}
+
+// isMutation reports whether r would change state and so must be refused in
+// maintenance mode. Reads, POSTs that only inspect or test something, the
+// maintenance toggles themselves, and MCP calls to read-only tools stay
+// available.
+func isMutation(r *http.Request) bool {
+	if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/maintenance/") {
+		return false
+	}
+	if r.Method == "POST" && isReadOnlyPost(r) {
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// isReadOnlyPost reports whether r is one of the POST endpoints that change
+// nothing: previews, duplicate checks, command validation, dry runs and test
+// notifications.
+func isReadOnlyPost(r *http.Request) bool {
+	if r.URL.Path == "/api/notifications/test" {
+		return true
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "api" || parts[1] != "tasks" {
+		return false
+	}
+	if len(parts) == 3 {
+		return parts[2] == "preview" || parts[2] == "duplicate-check"
+	}
+	if len(parts) != 4 {
+		return false
+	}
+	switch parts[3] {
+	case "validate-command":
+		return true
+	case "run":
+		dry, _ := strconv.ParseBool(r.URL.Query().Get("dry"))
+		return dry
+	}
+	return false
+}
+
+// mcpMutatingTools are refused in maintenance mode.
+var mcpMutatingTools = map[string]bool{
+	"create_task": true,
+	"update_task": true,
+	"delete_task": true,
+	"run_task":    true,
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Field names stay snake_case unless camelCase is asked for, in which
+	// case JSON responses are rewritten on the way out.
+	if camelCaseRequested(r) {
+		cw := &camelCaseWriter{ResponseWriter: w}
+		defer cw.finish()
+		w = cw
+	}
+
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, api.bodyLimit(r.URL.Path))
+	}
+
+	// Trigger URLs authenticate with their own token instead of the API key.
+	if strings.HasPrefix(r.URL.Path, "/api/triggers/") {
+		api.handleTrigger(w, r)
+		return
+	}
+
+	// The API description is public so clients can be generated from it.
+	if r.URL.Path == "/api/openapi.json" {
+		api.handleOpenAPI(w, r)
+		return
+	}
+
+	// Health checks come from load balancers without credentials.
+	if r.URL.Path == "/healthz" {
+		api.handleHealthz(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/mcp" || r.URL.Path == "/metrics" {
+		label, ok := apiKeyLabel(r.Header.Get("X-API-Key"))
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), apiKeyLabelKey{}, label))
+	}
+
+	// Checked after authentication so unauthenticated callers learn nothing
+	// about the server's state.
+	if api.Engine.Maintenance() && isMutation(r) {
+		refuseInMaintenance(w)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/tasks") {
+		api.handleTasks(w, r)
+		return
+	}
+	if r.URL.Path == "/api/maintenance/on" || r.URL.Path == "/api/maintenance/off" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		on := r.URL.Path == "/api/maintenance/on"
+		if err := api.Engine.SetMaintenance(on); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"maintenance": on})
+		return
+	}
+	if r.URL.Path == "/api/config" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.Config)
+		return
+	}
+	if r.URL.Path == "/api/scheduler/status" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.Engine.Status())
+		return
+	}
+	if r.URL.Path == "/api/scheduler/tick" {
+		// Only for testing schedules: it starts real runs early.
+		if !api.DevMode {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		window := defaultTickWindow
+		if val := r.URL.Query().Get("window"); val != "" {
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				http.Error(w, "Invalid window", http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.Engine.FireDue(window))
+		return
+	}
+	if r.URL.Path == "/api/queue" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.Engine.Queue())
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/batches/") {
+		api.handleBatches(w, r)
+		return
+	}
+	if r.URL.Path == "/api/notifications/test" {
+		api.handleNotificationTest(w, r)
+		return
+	}
+	if r.URL.Path == "/api/folders" {
+		api.handleFolders(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/runs") {
+		api.handleRuns(w, r)
+		return
+	}
+	if r.URL.Path == "/mcp" {
+		api.handleMCP(w, r)
+		return
+	}
+	if r.URL.Path == "/metrics" {
+		api.handleMetrics(w, r)
+		return
+	}
+	// Serve static files for everything else
+	fs := http.FileServer(http.Dir("./static"))
+	fs.ServeHTTP(w, r)
+}
+
+// heartbeatStaleAfter is how many missed heartbeats make /healthz report
+// the scheduler as wedged.
+const heartbeatStaleAfter = 3 * engine.HeartbeatInterval
+
+func (api *API) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{"status": "ok"}
+	if last, ok := api.Engine.LastHeartbeat(); ok {
+		resp["last_heartbeat"] = last
+		if time.Since(last) > heartbeatStaleAfter {
+			resp["status"] = "stale"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (api *API) handleMCP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		JSONRPC string                 `json:"jsonrpc"`
+		ID      interface{}            `json:"id"`
+		Method  string                 `json:"method"`
+		Params  map[string]interface{} `json:"params"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeDecodeError(w, err)
+			return
+		}
+		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	sendResponse := func(result interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  result,
+		})
+	}
+
+	sendError := func(code int, message string, data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"error": map[string]interface{}{
+				"code":    code,
+				"message": message,
+				"data":    data,
+			},
+		})
+	}
+
+	switch req.Method {
+	case "initialize":
+		requested, _ := req.Params["protocolVersion"].(string)
+		version, err := negotiateProtocolVersion(requested)
+		if err != nil {
+			sendError(-32602, err.Error(), map[string]interface{}{
+				"supported": mcpProtocolVersions,
+				"requested": requested,
+			})
+			return
+		}
+		sendResponse(map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "opencron", "version": "1.0.0"},
+		})
+
+	case "notifications/initialized":
+		w.WriteHeader(http.StatusNoContent)
+
+	case "tools/list":
+		tools := []map[string]interface{}{
+			{
+				"name":        "list_tasks",
+				"description": "List all scheduled cron tasks",
+				"inputSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+			},
+			{
+				"name":        "create_task",
+				"description": "Create a new cron task",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":            map[string]interface{}{"type": "string"},
+						"schedule":        map[string]interface{}{"type": "string", "description": "Standard cron expression (e.g. * * * * *)"},
+						"command":         map[string]interface{}{"type": "string"},
+						"enabled":         map[string]interface{}{"type": "boolean"},
+						"one_shot":        map[string]interface{}{"type": "boolean"},
+						"command_windows": map[string]interface{}{"type": "string", "description": "Replaces command on Windows hosts"},
+						"command_unix":    map[string]interface{}{"type": "string", "description": "Replaces command on non-Windows hosts"},
+					},
+					"required": []string{"name", "schedule"},
+					// One of the commands is enough; validation checks the task has one.
+					"anyOf": []map[string]interface{}{
+						{"required": []string{"command"}},
+						{"required": []string{"command_windows"}},
+						{"required": []string{"command_unix"}},
+					},
+				},
+			},
+			{
+				"name":        "update_task",
+				"description": "Update a cron task by ID. Supports partial updates, including command changes.",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":              map[string]interface{}{"type": "integer"},
+						"name":            map[string]interface{}{"type": "string"},
+						"schedule":        map[string]interface{}{"type": "string", "description": "Standard cron expression (e.g. * * * * *)"},
+						"command":         map[string]interface{}{"type": "string"},
+						"enabled":         map[string]interface{}{"type": "boolean"},
+						"one_shot":        map[string]interface{}{"type": "boolean"},
+						"command_windows": map[string]interface{}{"type": "string", "description": "Replaces command on Windows hosts"},
+						"command_unix":    map[string]interface{}{"type": "string", "description": "Replaces command on non-Windows hosts"},
+					},
+					"required": []string{"id"},
+				},
+			},
+			{
+				"name":        "delete_task",
+				"description": "Delete a cron task by ID. Locked tasks are refused unless force is true.",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":    map[string]interface{}{"type": "integer"},
+						"force": map[string]interface{}{"type": "boolean"},
+					},
+					"required": []string{"id"},
+				},
+			},
+			{
+				"name":        "run_task",
+				"description": "Run a task immediately by ID. Returns a run id without waiting unless wait is true; poll get_task_runs for the outcome. With a progressToken, waits and streams output as progress notifications.",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":      map[string]interface{}{"type": "integer"},
+						"wait":    map[string]interface{}{"type": "boolean", "description": "Wait for the run to finish, up to a server-side timeout"},
+						"dry_run": map[string]interface{}{"type": "boolean", "description": "Only resolve and return the command that would run, without executing it"},
+					},
+					"required": []string{"id"},
+				},
+			},
+			{
+				"name":        "get_task_runs",
+				"description": "List a task's run history by ID, most recent first",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id": map[string]interface{}{"type": "integer"},
+					},
+					"required": []string{"id"},
+				},
+			},
+		}
+		sendResponse(map[string]interface{}{"tools": tools})
+
+	case "tools/call":
+		toolName := req.Params["name"].(string)
+		args := req.Params["arguments"].(map[string]interface{})
+
+		if api.Engine.Maintenance() && mcpMutatingTools[toolName] {
+			sendResponse(map[string]interface{}{
+				"isError": true,
+				"content": []map[string]interface{}{{"type": "text", "text": "Service is in maintenance mode; changes are temporarily disabled"}},
+			})
+			return
+		}
+
+		var content []map[string]interface{}
+		var err error
+
+		switch toolName {
+		case "list_tasks":
+			tasks, e := api.Store.GetTasks()
+			if e == nil {
+				redactTriggerTokens(tasks)
 				data, _ := json.Marshal(tasks)
 				content = append(content, map[string]interface{}{"type": "text", "text": string(data)})
 			}
 			err = e
 		case "create_task":
 			t := &models.Task{
-				Name:     args["name"].(string),
-				Schedule: args["schedule"].(string),
-				Command:  args["command"].(string),
-				Enabled:  true,
+				Name:      args["name"].(string),
+				Schedule:  args["schedule"].(string),
+				Enabled:   true,
+				CreatedBy: mcpCreator,
 			}
+			t.Command, _ = args["command"].(string)
 			if val, ok := args["enabled"].(bool); ok {
 				t.Enabled = val
 			}
 			if val, ok := args["one_shot"].(bool); ok {
 				t.OneShot = val
 			}
-			err = api.Store.CreateTask(t)
+			if val, ok := args["command_windows"].(string); ok {
+				t.CommandWindows = val
+			}
+			if val, ok := args["command_unix"].(string); ok {
+				t.CommandUnix = val
+			}
+			if err = api.validateTask(t); err != nil {
+				break
+			}
+			if err = api.checkTaskQuota(); err != nil {
+				break
+			}
+			if err = api.Store.CreateTask(t); err != nil {
+				break
+			}
 			api.Engine.Reload()
 			data, _ := json.Marshal(t)
 			content = append(content, map[string]interface{}{"type": "text", "text": "Task created: " + string(data)})
 		case "delete_task":
 			id := int(args["id"].(float64))
-			err = api.Store.DeleteTask(id)
-			api.Engine.Reload()
+			force, _ := args["force"].(bool)
+			if err = api.deleteTask(id, force); err != nil {
+				break
+			}
 			content = append(content, map[string]interface{}{"type": "text", "text": "Task deleted successfully"})
 		case "run_task":
 			idValue, ok := args["id"]
@@ -228,11 +1205,58 @@ func (api *API) handleMCP(w http.ResponseWriter, r *http.Request) {
 				err = convErr
 				break
 			}
-			err = api.Engine.RunTaskNow(id)
-			if err != nil {
+			if dryRun, _ := args["dry_run"].(bool); dryRun {
+				result, dryErr := api.Engine.DryRunTask(id)
+				if dryErr != nil {
+					err = dryErr
+					break
+				}
+				data, _ := json.Marshal(result)
+				content = append(content, map[string]interface{}{"type": "text", "text": fmt.Sprintf("Dry run of task %d: %s", id, data)})
+				break
+			}
+			if meta, _ := req.Params["_meta"].(map[string]interface{}); meta["progressToken"] != nil {
+				api.streamRunProgress(w, r, req.ID, id, meta["progressToken"])
+				return
+			}
+			runID, done, startErr := api.Engine.RunTaskNow(id)
+			if startErr != nil {
+				err = startErr
+				break
+			}
+			if wait, _ := args["wait"].(bool); !wait {
+				content = append(content, map[string]interface{}{"type": "text", "text": fmt.Sprintf("Task %d started as run #%d", id, runID)})
+				break
+			}
+			select {
+			case result := <-done:
+				data, _ := json.Marshal(result)
+				if result.Err != nil {
+					err = fmt.Errorf("run #%d of task %d failed: %s", runID, id, data)
+					break
+				}
+				content = append(content, map[string]interface{}{"type": "text", "text": fmt.Sprintf("Task %d executed as run #%d: %s", id, runID, data)})
+			case <-time.After(mcpRunWaitTimeout):
+				content = append(content, map[string]interface{}{"type": "text", "text": fmt.Sprintf("Run #%d of task %d still running after %s; poll get_task_runs for the outcome", runID, id, mcpRunWaitTimeout)})
+			}
+		case "get_task_runs":
+			idValue, ok := args["id"]
+			if !ok {
+				err = fmt.Errorf("missing required field: id")
+				break
+			}
+			id, convErr := toInt(idValue)
+			if convErr != nil {
+				err = convErr
+				break
+			}
+			runs, e := api.Store.GetRuns(id)
+			if e != nil {
+				err = e
 				break
 			}
-			content = append(content, map[string]interface{}{"type": "text", "text": fmt.Sprintf("Task %d executed", id)})
+			data, _ := json.Marshal(runs)
+			content = append(content, map[string]interface{}{"type": "text", "text": string(data)})
 		case "update_task":
 			idValue, ok := args["id"]
 			if !ok {
@@ -269,131 +1293,855 @@ func (api *API) handleMCP(w http.ResponseWriter, r *http.Request) {
 				existing.Command = val
 				updated = true
 			}
-			if val, ok := args["enabled"].(bool); ok {
-				existing.Enabled = val
-				updated = true
+			if val, ok := args["enabled"].(bool); ok {
+				existing.Enabled = val
+				updated = true
+			}
+			if val, ok := args["one_shot"].(bool); ok {
+				existing.OneShot = val
+				updated = true
+			}
+			if val, ok := args["command_windows"].(string); ok {
+				existing.CommandWindows = val
+				updated = true
+			}
+			if val, ok := args["command_unix"].(string); ok {
+				existing.CommandUnix = val
+				updated = true
+			}
+			if !updated {
+				err = fmt.Errorf("at least one field to update is required")
+				break
+			}
+			if err = api.validateTask(existing); err != nil {
+				break
+			}
+
+			existing.ModifiedBy = mcpCreator
+			err = api.Store.UpdateTask(existing)
+			if err != nil {
+				break
+			}
+			api.Engine.Reload()
+			data, _ := json.Marshal(existing)
+			content = append(content, map[string]interface{}{"type": "text", "text": "Task updated: " + string(data)})
+		default:
+			http.Error(w, "Unknown tool", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			sendResponse(map[string]interface{}{
+				"isError": true,
+				"content": []map[string]interface{}{{"type": "text", "text": err.Error()}},
+			})
+		} else {
+			sendResponse(map[string]interface{}{"content": content})
+		}
+
+	default:
+		sendResponse(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    -32601,
+				"message": "Method not found",
+			},
+		})
+	}
+}
+
+// notificationTestRequest is the body of POST /api/notifications/test. With
+// only task_id, the task's notify_url is tested.
+type notificationTestRequest struct {
+	URL    string `json:"url"`
+	TaskID int    `json:"task_id"`
+}
+
+func (api *API) handleNotificationTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req notificationTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	var task models.Task
+	if req.TaskID != 0 {
+		t, err := api.Store.GetTaskByID(req.TaskID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Task not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		task = *t
+		if req.URL == "" {
+			req.URL = task.NotifyURL
+		}
+	}
+	if req.URL == "" {
+		http.Error(w, "url or a task_id with a notify_url is required", http.StatusBadRequest)
+		return
+	}
+	if task.Name == "" {
+		task.Name = "opencron test"
+	}
+
+	result, err := engine.SendTestNotification(req.URL, task)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("notification failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeIdempotentTask responds to a repeated create with the task the original
+// request created.
+func (api *API) writeIdempotentTask(w http.ResponseWriter, id int) {
+	t, err := api.Store.GetTaskByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	json.NewEncoder(w).Encode(t)
+}
+
+func (api *API) handleTasks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	// parts will be ["api", "tasks"], ["api", "tasks", "ID"], ["api", "tasks", "ID", "logs"], ["api", "tasks", "ID", "runs"], or ["api", "tasks", "ID", "run"]
+
+	switch r.Method {
+	case "GET":
+		if len(parts) == 2 {
+			sortBy := r.URL.Query().Get("sort")
+			if sortBy != "next_run" && !store.IsTaskOrder(sortBy) {
+				http.Error(w, "Invalid sort, expected name, created or next_run", http.StatusBadRequest)
+				return
+			}
+			var tasks []models.Task
+			var err error
+			if sortBy == "next_run" {
+				tasks, err = api.Store.GetTasks()
+			} else {
+				tasks, err = api.Store.GetTasksSorted(sortBy)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if sortBy == "next_run" {
+				sortTasksByNextRun(tasks, api.Engine.Now())
+			}
+			if broken, _ := strconv.ParseBool(r.URL.Query().Get("broken")); broken {
+				tasks = filterBrokenTasks(tasks)
+			}
+			if folder := r.URL.Query().Get("folder"); folder != "" {
+				tasks = filterTasksInFolder(tasks, normalizeFolder(folder))
+			}
+			redactTriggerTokens(tasks)
+			data, err := json.Marshal(tasks)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			etag := weakETag(data)
+			w.Header().Set("ETag", etag)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write(append(data, '\n'))
+			return
+		}
+
+		if len(parts) == 3 && parts[2] == "upcoming" {
+			within := time.Hour
+			if val := r.URL.Query().Get("within"); val != "" {
+				d, err := time.ParseDuration(val)
+				if err != nil || d <= 0 {
+					http.Error(w, "Invalid within duration", http.StatusBadRequest)
+					return
+				}
+				within = d
+			}
+			tasks, err := api.Store.GetTasks()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			redactTriggerTokens(tasks)
+			json.NewEncoder(w).Encode(upcomingTasks(tasks, api.Engine.Now(), within))
+			return
+		}
+
+		if len(parts) == 3 {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			t, err := api.Store.GetTaskByID(id)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rate, count, err := api.Store.SuccessRate(id, successRateRuns)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("ETag", versionETag(t.Version))
+			json.NewEncoder(w).Encode(taskDetail{Task: *t, LogBytes: engine.LogBytes(api.DataDir, id), SuccessRate: rate, RunCount: count})
+			return
+		}
+
+		if len(parts) == 6 && parts[3] == "runs" && parts[5] == "logs" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			runID, err := strconv.Atoi(parts[4])
+			if err != nil {
+				http.Error(w, "Invalid run ID", http.StatusBadRequest)
+				return
+			}
+			run, err := api.Store.GetRun(id, runID)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Run not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			content, err := engine.RunLog(api.DataDir, run)
+			if err != nil {
+				if os.IsNotExist(err) {
+					http.Error(w, "Log file not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(content)
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "schedule" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			count := defaultScheduleCount
+			if val := r.URL.Query().Get("count"); val != "" {
+				count, err = strconv.Atoi(val)
+				if err != nil || count < 1 || count > maxScheduleCount {
+					http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxScheduleCount), http.StatusBadRequest)
+					return
+				}
+			}
+			t, err := api.Store.GetTaskByID(id)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// Like next_run, fires during a snooze are skipped.
+			from := api.Engine.Now()
+			if t.PausedUntil.After(from) {
+				from = t.PausedUntil.In(from.Location())
+			}
+			runs, err := engine.NextTaskRuns(*t, from, count)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid schedule %q: %v", t.Schedule, err), http.StatusUnprocessableEntity)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"schedule":  t.Schedule,
+				"schedules": t.Schedules,
+				"next_runs": runs,
+			})
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "duplicate-check" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			t, err := api.Store.GetTaskByID(id)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			similar, err := api.Store.FindSimilar(t.Name, t.Command, t.Schedule, t.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			redactTriggerTokens(similar)
+			json.NewEncoder(w).Encode(similar)
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "history" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			history, err := api.Store.GetTaskChanges(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(history)
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "runs" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			runs, err := api.Store.GetRuns(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(runs)
+			return
+		}
+
+		if len(parts) == 5 && parts[3] == "logs" && parts[4] == "size" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]int64{"log_bytes": engine.LogBytes(api.DataDir, id)})
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "archive" {
+			api.handleTaskArchive(w, r, parts[2])
+			return
+		}
+
+		if len(parts) == 5 && parts[3] == "logs" && parts[4] == "search" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			query := r.URL.Query()
+			q := query.Get("q")
+			if q == "" {
+				http.Error(w, "q is required", http.StatusBadRequest)
+				return
+			}
+			// A bare ?case_insensitive turns it on.
+			caseInsensitive := query.Has("case_insensitive")
+			if val := query.Get("case_insensitive"); val != "" {
+				if caseInsensitive, err = strconv.ParseBool(val); err != nil {
+					http.Error(w, "Invalid case_insensitive", http.StatusBadRequest)
+					return
+				}
+			}
+			limit := defaultLogSearchLimit
+			if val := query.Get("limit"); val != "" {
+				if limit, err = strconv.Atoi(val); err != nil || limit <= 0 {
+					http.Error(w, "Invalid limit", http.StatusBadRequest)
+					return
+				}
+			}
+
+			// Matches are streamed as newline-delimited JSON as they are
+			// found rather than collected first.
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			rc := http.NewResponseController(w)
+			enc := json.NewEncoder(w)
+			found := 0
+			err = engine.SearchLogs(api.DataDir, id, q, caseInsensitive, func(m engine.LogMatch) error {
+				if err := enc.Encode(m); err != nil {
+					return err
+				}
+				if found++; found >= limit {
+					return errLogSearchLimit
+				}
+				if found%logSearchFlushEvery == 0 {
+					rc.Flush()
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errLogSearchLimit) {
+				log.Printf("Log search of task %d stopped: %v", id, err)
+			}
+			return
+		}
+
+		if len(parts) == 5 && parts[3] == "logs" && parts[4] == "files" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			files := engine.ListLogFiles(api.DataDir, id)
+			if files == nil {
+				files = []engine.LogFileInfo{}
+			}
+			json.NewEncoder(w).Encode(files)
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "logs" {
+			id, _ := strconv.Atoi(parts[2])
+			matches := engine.LogFiles(api.DataDir, id)
+			if name := r.URL.Query().Get("file"); name != "" {
+				path, ok := engine.LogFilePath(api.DataDir, id, name)
+				if !ok {
+					http.Error(w, "Log file not found", http.StatusNotFound)
+					return
+				}
+				matches = []string{path}
+			}
+
+			download, _ := strconv.ParseBool(r.URL.Query().Get("download"))
+			if strings.Contains(r.Header.Get("Accept"), "application/json") {
+				format := models.OutputFormatText
+				if t, err := api.Store.GetTaskByID(id); err == nil && t.OutputFormat != "" {
+					format = t.OutputFormat
+				}
+				pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+				files := []logFileContent{}
+				for _, match := range matches {
+					content, err := os.ReadFile(match)
+					if err != nil {
+						continue
+					}
+					runs := engine.ParseLogRuns(content)
+					if pretty && format == models.OutputFormatJSON {
+						content = prettyJSONLines(content)
+					}
+					files = append(files, logFileContent{Name: filepath.Base(match), Content: string(content), Runs: runs})
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if download {
+					w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%d_logs.json"`, id))
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"task_id": id, "output_format": format, "files": files})
+				return
+			}
+
+			if len(matches) == 0 {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("No logs found for this task."))
+				return
+			}
+
+			var sb strings.Builder
+			for _, match := range matches {
+				content, err := os.ReadFile(match)
+				if err != nil {
+					continue
+				}
+				sb.Write(content)
+			}
+
+			w.Header().Set("Content-Type", "text/plain")
+			if download {
+				w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%d_logs.txt"`, id))
+			}
+			w.Write([]byte(sb.String()))
+			return
+		}
+	case "POST":
+		if len(parts) == 4 && parts[3] == "run" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if dry, _ := strconv.ParseBool(r.URL.Query().Get("dry")); dry {
+				result, err := api.Engine.DryRunTask(id)
+				if err != nil {
+					if errors.Is(err, sql.ErrNoRows) {
+						http.Error(w, "Task not found", http.StatusNotFound)
+						return
+					}
+					http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+					return
+				}
+				json.NewEncoder(w).Encode(result)
+				return
+			}
+			req := runRequest{DedupKey: r.URL.Query().Get("dedup_key")}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+					writeDecodeError(w, err)
+					return
+				}
+			}
+			runID, done, deduplicated, err := api.Engine.RunTaskDedup(id, req.DedupKey)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				if errors.Is(err, engine.ErrMaxInstances) {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// With wait=true the result is returned once the run finishes.
+			// A run outlasting runWaitTimeout carries on and is reported like
+			// an asynchronous one.
+			if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+				select {
+				case res := <-done:
+					json.NewEncoder(w).Encode(res)
+					return
+				case <-time.After(runWaitTimeout):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			if deduplicated {
+				json.NewEncoder(w).Encode(map[string]interface{}{"run_id": runID, "deduplicated": true})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]int{"run_id": runID})
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "trigger-token" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if _, err := api.Store.GetTaskByID(id); err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			token, err := store.NewTriggerToken()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := api.Store.SetTriggerToken(id, token); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"trigger_token": token})
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "snooze" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			var body struct {
+				Duration string `json:"duration"`
 			}
-			if val, ok := args["one_shot"].(bool); ok {
-				existing.OneShot = val
-				updated = true
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeDecodeError(w, err)
+				return
 			}
-			if !updated {
-				err = fmt.Errorf("at least one field to update is required")
-				break
+			d, err := time.ParseDuration(body.Duration)
+			if err != nil || d < 0 {
+				http.Error(w, "Invalid duration", http.StatusBadRequest)
+				return
 			}
 
-			err = api.Store.UpdateTask(existing)
+			existing, err := api.Store.GetTaskByID(id)
 			if err != nil {
-				break
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// A zero duration clears an existing snooze.
+			existing.PausedUntil = time.Time{}
+			if d > 0 {
+				existing.PausedUntil = time.Now().Add(d)
+			}
+			existing.ModifiedBy = requestCreator(r)
+			if err := api.Store.UpdateTask(existing); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
 			api.Engine.Reload()
-			data, _ := json.Marshal(existing)
-			content = append(content, map[string]interface{}{"type": "text", "text": "Task updated: " + string(data)})
-		default:
-			http.Error(w, "Unknown tool", http.StatusNotFound)
+			json.NewEncoder(w).Encode(existing)
 			return
 		}
 
-		if err != nil {
-			sendResponse(map[string]interface{}{
-				"isError": true,
-				"content": []map[string]interface{}{{"type": "text", "text": err.Error()}},
-			})
-		} else {
-			sendResponse(map[string]interface{}{"content": content})
+		if len(parts) == 4 && parts[3] == "validate-command" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			resolved, err := api.Engine.DryRunTask(id)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			result := commandValidation{Valid: true, Commands: []commandArgv{}}
+			for _, command := range resolved.Commands {
+				c := commandArgv{Command: command}
+				if argv, err := engine.SplitArgs(command); err != nil {
+					c.Error = err.Error()
+					result.Valid = false
+				} else {
+					c.Argv = argv
+				}
+				result.Commands = append(result.Commands, c)
+			}
+			json.NewEncoder(w).Encode(result)
+			return
 		}
 
-	default:
-		sendResponse(map[string]interface{}{
-			"error": map[string]interface{}{
-				"code":    -32601,
-				"message": "Method not found",
-			},
-		})
-	}
-}
-
-func (api *API) handleTasks(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
-	// parts will be ["api", "tasks"], ["api", "tasks", "ID"], ["api", "tasks", "ID", "logs"], or ["api", "tasks", "ID", "run"]
-
-	switch r.Method {
-	case "GET":
-		if len(parts) == 2 {
-			tasks, err := api.Store.GetTasks()
+		if len(parts) == 4 && (parts[3] == "lock" || parts[3] == "unlock") {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if err := api.Store.SetTaskLocked(id, parts[3] == "lock", requestCreator(r)); err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			t, err := api.Store.GetTaskByID(id)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			json.NewEncoder(w).Encode(tasks)
+			json.NewEncoder(w).Encode(t)
 			return
 		}
 
-		if len(parts) == 4 && parts[3] == "logs" {
-			id, _ := strconv.Atoi(parts[2])
-			logsDir := filepath.Join(api.DataDir, "logs")
-
-			// Pattern to match legacy task_ID.log and daily task_ID_YYYYMMDD.log
-			// We use two patterns to be precise and avoid matching task_10 when id is 1
-			legacyPath := filepath.Join(logsDir, fmt.Sprintf("task_%d.log", id))
-			dailyPattern := filepath.Join(logsDir, fmt.Sprintf("task_%d_*.log", id))
-
-			matches, _ := filepath.Glob(dailyPattern)
-			if _, err := os.Stat(legacyPath); err == nil {
-				matches = append([]string{legacyPath}, matches...)
+		if len(parts) == 4 && parts[3] == "reset" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
 			}
-
-			if len(matches) == 0 {
-				w.Header().Set("Content-Type", "text/plain")
-				w.Write([]byte("No logs found for this task."))
+			if err := api.Store.ResetTaskFailures(id, requestCreator(r)); err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, "Task not found", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			api.Engine.Reload()
+			t, err := api.Store.GetTaskByID(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(t)
+			return
+		}
 
-			// Sort matches to ensure order (lexicographical should work for task_ID_YYYYMMDD.log)
-			// task_ID.log (if it exists) will come before task_ID_YYYYMMDD.log because . comes before _
-			// Actually _ comes after . in ASCII? Let's check: '.' is 46, '_' is 95.
-			// So task_1.log will be before task_1_20260212.log.
-
-			var sb strings.Builder
-			for _, match := range matches {
-				content, err := os.ReadFile(match)
+		if len(parts) == 3 && parts[2] == "import" {
+			var req taskImportRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeDecodeError(w, err)
+				return
+			}
+			for i := range req.Tasks {
+				req.Tasks[i].Folder = normalizeFolder(req.Tasks[i].Folder)
+				req.Tasks[i].CreatedBy = requestCreator(r)
+			}
+			if api.MaxTasks > 0 {
+				n, err := api.Store.CountTasks()
 				if err != nil {
-					continue
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
 				}
-				sb.Write(content)
+				if n+len(req.Tasks) > api.MaxTasks {
+					http.Error(w, fmt.Sprintf("%v: importing %d tasks would exceed %d", errTaskQuota, len(req.Tasks), api.MaxTasks), http.StatusForbidden)
+					return
+				}
+			}
+			// Every entry is checked, schedules included, so one response
+			// lists all the bad ones; nothing is imported if there are any.
+			remapped, err := api.Store.ImportTasks(req.Tasks, req.PreserveIDs, func(t models.Task) []string {
+				return api.taskValidationErrors(&t)
+			})
+			var rejected *store.ImportError
+			if errors.As(err, &rejected) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": rejected.Tasks})
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			api.Engine.Reload()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"imported": len(req.Tasks),
+				"id_map":   remapped,
+			})
+			return
+		}
 
-			w.Header().Set("Content-Type", "text/plain")
-			w.Write([]byte(sb.String()))
+		if len(parts) == 3 && (parts[2] == "bulk-enable" || parts[2] == "bulk-disable") {
+			var req bulkEnableRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeDecodeError(w, err)
+				return
+			}
+			filter := store.TaskFilter{Folder: normalizeFolder(req.Folder), IDs: req.IDs}
+			if filter.Folder == "" && len(filter.IDs) == 0 {
+				http.Error(w, "folder or ids is required", http.StatusBadRequest)
+				return
+			}
+			ids, err := api.Store.SetEnabledByFilter(filter, parts[2] == "bulk-enable", requestCreator(r))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if len(ids) > 0 {
+				api.Engine.Reload()
+			}
+			json.NewEncoder(w).Encode(map[string][]int{"ids": ids})
 			return
 		}
-	case "POST":
-		if len(parts) == 4 && parts[3] == "run" {
-			id, err := strconv.Atoi(parts[2])
+
+		if len(parts) == 3 && parts[2] == "duplicate-check" {
+			var req duplicateCheckRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeDecodeError(w, err)
+				return
+			}
+			similar, err := api.Store.FindSimilar(req.Name, req.Command, req.Schedule, 0)
 			if err != nil {
-				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			if err := api.Engine.RunTaskNow(id); err != nil {
-				if errors.Is(err, sql.ErrNoRows) {
-					http.Error(w, "Task not found", http.StatusNotFound)
-					return
-				}
+			redactTriggerTokens(similar)
+			json.NewEncoder(w).Encode(similar)
+			return
+		}
+
+		if len(parts) == 3 && parts[2] == "preview" {
+			var t models.Task
+			if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+				writeDecodeError(w, err)
+				return
+			}
+			errs := api.taskValidationErrors(&t)
+			nextRuns, err := engine.NextTaskRuns(t, api.Engine.Now(), previewRunCount)
+			if err != nil {
+				nextRuns = []time.Time{}
+			}
+			similar, err := api.Store.FindSimilar(t.Name, t.Command, t.Schedule, t.ID)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			w.WriteHeader(http.StatusNoContent)
+			redactTriggerTokens(similar)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"valid":     len(errs) == 0,
+				"errors":    errs,
+				"next_runs": nextRuns,
+				"similar":   similar,
+			})
 			return
 		}
 
 		var t models.Task
 		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		t.Folder = normalizeFolder(t.Folder)
+		t.CreatedBy = requestCreator(r)
+		if err := api.validateTask(&t); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := api.Store.CreateTask(&t); err != nil {
+		// A retried request with the same Idempotency-Key gets the task the
+		// first one created instead of a duplicate.
+		key := r.Header.Get("Idempotency-Key")
+		if key != "" {
+			id, err := api.Store.IdempotentTaskID(key, api.idempotencySince())
+			if err == nil {
+				api.writeIdempotentTask(w, id)
+				return
+			}
+			if err != sql.ErrNoRows {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := api.checkTaskQuota(); err != nil {
+			if errors.Is(err, errTaskQuota) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if key != "" {
+			existingID, err := api.Store.CreateTaskIdempotent(&t, key, api.idempotencySince())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if existingID != 0 {
+				api.writeIdempotentTask(w, existingID)
+				return
+			}
+		} else if err := api.Store.CreateTask(&t); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -425,7 +2173,7 @@ func (api *API) handleTasks(w http.ResponseWriter, r *http.Request) {
 
 		var update taskUpdateRequest
 		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeDecodeError(w, err)
 			return
 		}
 		if update.isEmpty() {
@@ -433,28 +2181,178 @@ func (api *API) handleTasks(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// If-Match carries the version from an earlier read; a mismatch means
+		// someone else updated the task in between.
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch != "" && !etagMatches(ifMatch, versionETag(existing.Version)) {
+			http.Error(w, "Task was modified; reload and retry", http.StatusPreconditionFailed)
+			return
+		}
+
 		applyTaskUpdate(existing, update)
-		if err := api.Store.UpdateTask(existing); err != nil {
+		if err := api.validateTask(existing); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		existing.ModifiedBy = requestCreator(r)
+		if ifMatch != "" {
+			err = api.Store.UpdateTaskIfVersion(existing, existing.Version)
+		} else {
+			err = api.Store.UpdateTask(existing)
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrVersionMismatch) {
+				http.Error(w, "Task was modified; reload and retry", http.StatusPreconditionFailed)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		api.Engine.Reload()
+		w.Header().Set("ETag", versionETag(existing.Version))
 		json.NewEncoder(w).Encode(existing)
 	case "DELETE":
+		if len(parts) == 4 && parts[3] == "logs" {
+			id, err := strconv.Atoi(parts[2])
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			deleted, err := engine.DeleteLogs(api.DataDir, id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Deleted %d log files of task %d", deleted, id)
+			json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+			return
+		}
 		if len(parts) < 3 {
 			http.Error(w, "Invalid ID", http.StatusBadRequest)
 			return
 		}
 		id, _ := strconv.Atoi(parts[2])
-		if err := api.Store.DeleteTask(id); err != nil {
+		force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+		if err := api.deleteTask(id, force); err != nil {
+			if errors.Is(err, store.ErrTaskLocked) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		api.Engine.Reload()
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
+func (api *API) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/api/triggers/")
+	t, err := api.Store.GetTaskByTriggerToken(token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The token authenticates the caller, so maintenance is checked here.
+	if api.Engine.Maintenance() {
+		refuseInMaintenance(w)
+		return
+	}
+	// Disabling a task also turns off its trigger URL.
+	if !t.Enabled {
+		http.Error(w, "Task is disabled", http.StatusConflict)
+		return
+	}
+
+	runID, _, err := api.Engine.RunTaskNow(t.ID)
+	if err != nil {
+		if errors.Is(err, engine.ErrMaxInstances) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"run_id": runID})
+}
+
+func (api *API) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/runs/export" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if val := r.URL.Query().Get("since"); val != "" {
+		parsed, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			http.Error(w, "Invalid since, expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	taskID := 0
+	if val := r.URL.Query().Get("task_id"); val != "" {
+		id, err := strconv.Atoi(val)
+		if err != nil {
+			http.Error(w, "Invalid task_id", http.StatusBadRequest)
+			return
+		}
+		taskID = id
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	err := api.Store.EachRun(since, taskID, func(run models.Run) error {
+		return enc.Encode(run)
+	})
+	if err != nil {
+		// Headers are likely already sent, so the best we can do is log.
+		log.Printf("Failed to export runs: %v", err)
+	}
+}
+
+// weakETag derives a weak validator from a response body so polling clients
+// can skip unchanged task lists.
+func weakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// versionETag is the ETag of a single task, derived from its version.
+func versionETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the
+// weak comparison If-None-Match requires.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 func toInt(v interface{}) (int, error) {
 	switch n := v.(type) {
 	case int:
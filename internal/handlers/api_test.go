@@ -9,6 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -124,6 +126,9 @@ func TestUpdateTaskCommandViaMCP(t *testing.T) {
 	if updated.Command != "echo mcp" {
 		t.Fatalf("expected command to be updated by MCP, got %q", updated.Command)
 	}
+	if updated.ModifiedBy != mcpCreator {
+		t.Fatalf("expected modified_by %q like MCP creates, got %q", mcpCreator, updated.ModifiedBy)
+	}
 }
 
 func TestRunTaskNowViaAPI(t *testing.T) {
@@ -138,8 +143,22 @@ func TestRunTaskNowViaAPI(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	api.ServeHTTP(rec, req)
-	if rec.Code != http.StatusNoContent {
-		t.Fatalf("expected status 204, got %d, body=%s", rec.Code, rec.Body.String())
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var accepted struct {
+		RunID int `json:"run_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	runs := waitForRuns(t, api, task.ID)
+	if accepted.RunID != runs[0].ID {
+		t.Fatalf("expected run id %d, got %d", runs[0].ID, accepted.RunID)
+	}
+	if runs[0].Status != models.RunStatusSuccess {
+		t.Fatalf("expected run to succeed, got %q", runs[0].Status)
 	}
 
 	updated, err := api.Store.GetTaskByID(task.ID)
@@ -151,6 +170,92 @@ func TestRunTaskNowViaAPI(t *testing.T) {
 	}
 }
 
+func TestRunTaskWaitViaAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/tasks/%d/run?wait=true", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var result engine.RunResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if !result.Success || result.ExitCode != 0 || !strings.Contains(result.Output, "opencron") || result.RunID == 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestRunTaskDedupViaAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+
+	run := func(target string, body string) (int, bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var accepted struct {
+			RunID        int  `json:"run_id"`
+			Deduplicated bool `json:"deduplicated"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return accepted.RunID, accepted.Deduplicated
+	}
+
+	target := fmt.Sprintf("/api/tasks/%d/run", task.ID)
+	first, deduplicated := run(target, `{"dedup_key":"retry-1"}`)
+	if deduplicated {
+		t.Fatalf("expected the first run not to be deduplicated")
+	}
+	// The key may also come as a query parameter.
+	second, deduplicated := run(target+"?dedup_key=retry-1", "")
+	if !deduplicated || second != first {
+		t.Fatalf("expected run %d to be returned again, got %d (deduplicated=%v)", first, second, deduplicated)
+	}
+
+	// A waiting repeat gets the first run's result.
+	req := httptest.NewRequest(http.MethodPost, target+"?wait=true&dedup_key=retry-1", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	var result engine.RunResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if rec.Code != http.StatusOK || result.RunID != first || !result.Success {
+		t.Fatalf("expected the result of run %d, got %d %+v", first, rec.Code, result)
+	}
+
+	runs, err := api.Store.GetRuns(task.ID)
+	if err != nil {
+		t.Fatalf("GetRuns failed: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected a single run, got %d", len(runs))
+	}
+
+	if other, deduplicated := run(target+"?dedup_key=retry-2", ""); deduplicated || other == first {
+		t.Fatalf("expected a different key to start a new run, got %d (deduplicated=%v)", other, deduplicated)
+	}
+	waitForRuns(t, api, task.ID)
+}
+
 func TestRunTaskViaMCP(t *testing.T) {
 	api := newTestAPI(t)
 	task := seedTask(t, api)
@@ -166,7 +271,8 @@ func TestRunTaskViaMCP(t *testing.T) {
 		"params": map[string]interface{}{
 			"name": "run_task",
 			"arguments": map[string]interface{}{
-				"id": task.ID,
+				"id":   task.ID,
+				"wait": true,
 			},
 		},
 	}
@@ -226,3 +332,1898 @@ func TestGetLogsAPI(t *testing.T) {
 		t.Fatalf("expected concatenated logs %q, got %q", expected, rec.Body.String())
 	}
 }
+
+func TestGetRunsAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+	if _, err := api.Engine.RunTaskSync(task.ID); err != nil {
+		t.Fatalf("failed to run task: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/runs", task.ID), nil)
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var runs []models.Run
+	if err := json.Unmarshal(rec.Body.Bytes(), &runs); err != nil {
+		t.Fatalf("failed to decode runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if runs[0].Status != models.RunStatusSuccess {
+		t.Fatalf("expected run status %q, got %q", models.RunStatusSuccess, runs[0].Status)
+	}
+
+	content, err := os.ReadFile(filepath.Join(api.DataDir, "logs", runs[0].LogFile))
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	header := fmt.Sprintf("--- Run #%d of task %s started at", runs[0].ID, task.Name)
+	if !bytes.Contains(content, []byte(header)) {
+		t.Fatalf("expected log to contain %q, got %q", header, content)
+	}
+}
+
+func TestGetRunLogsReturnsOnlyThatRun(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	var runIDs []int
+	for i := 0; i < 2; i++ {
+		result, err := api.Engine.RunTaskSync(task.ID)
+		if err != nil {
+			t.Fatalf("run %d failed: %v", i, err)
+		}
+		runIDs = append(runIDs, result.RunID)
+	}
+
+	for i, runID := range runIDs {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/runs/%d/logs", task.ID, runID), nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, fmt.Sprintf("--- Run #%d ", runID)) || !strings.Contains(body, "before") {
+			t.Fatalf("expected run %d output, got %q", runID, body)
+		}
+		other := runIDs[1-i]
+		if strings.Contains(body, fmt.Sprintf("--- Run #%d ", other)) {
+			t.Fatalf("expected only run %d output, got %q", runID, body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/runs/%d/logs", task.ID+1, runIDs[0]), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for another task's run, got %d", rec.Code)
+	}
+}
+
+func TestGetRunLogsOfRunningRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	first, err := api.Engine.RunTaskSync(task.ID)
+	if err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	task.Command = "echo during; sleep 1"
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	runID, done, err := api.Engine.RunTaskNow(task.ID)
+	if err != nil {
+		t.Fatalf("failed to start second run: %v", err)
+	}
+	defer func() { <-done }()
+
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/runs/%d/logs", task.ID, runID), nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		if body = rec.Body.String(); strings.Contains(body, "during") {
+			break
+		}
+	}
+	if !strings.Contains(body, "during") {
+		t.Fatalf("expected the running run's output, got %q", body)
+	}
+	if strings.Contains(body, fmt.Sprintf("--- Run #%d ", first.RunID)) || strings.Contains(body, "before") {
+		t.Fatalf("expected only run %d output, got %q", runID, body)
+	}
+}
+
+func TestCreateTaskIdempotencyKey(t *testing.T) {
+	api := newTestAPI(t)
+
+	create := func(key string) models.Task {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"provisioned","schedule":"* * * * *","command":"echo hi","enabled":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var task models.Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &task); err != nil {
+			t.Fatalf("failed to decode task: %v", err)
+		}
+		return task
+	}
+
+	first := create("abc")
+	again := create("abc")
+	if again.ID != first.ID {
+		t.Fatalf("expected repeat to return task %d, got %d", first.ID, again.ID)
+	}
+	other := create("def")
+	if other.ID == first.ID {
+		t.Fatalf("expected a new task for a different key")
+	}
+	if n, _ := api.Store.CountTasks(); n != 2 {
+		t.Fatalf("expected 2 tasks, got %d", n)
+	}
+
+	// Once the key has expired the same key creates a new task.
+	api.IdempotencyKeyTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if expired := create("abc"); expired.ID == first.ID {
+		t.Fatalf("expected a new task after the key expired")
+	}
+}
+
+func TestGetTaskSchedule(t *testing.T) {
+	api := newTestAPI(t)
+	task := models.Task{Name: "hourly", Schedule: "@every 1h", Command: "echo hi", Enabled: true}
+	if err := api.Store.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/schedule?count=3", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		NextRuns []time.Time `json:"next_runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode schedule: %v", err)
+	}
+	if len(body.NextRuns) != 3 {
+		t.Fatalf("expected 3 runs, got %v", body.NextRuns)
+	}
+	for i := 1; i < len(body.NextRuns); i++ {
+		if gap := body.NextRuns[i].Sub(body.NextRuns[i-1]); gap != time.Hour {
+			t.Fatalf("expected runs an hour apart, got %s", gap)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/schedule?count=100000", task.ID), nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an excessive count, got %d", rec.Code)
+	}
+}
+
+func TestBulkDisableByFolder(t *testing.T) {
+	api := newTestAPI(t)
+	var ids []int
+	for _, folder := range []string{"team-a", "team-a/nightly", "team-ab", ""} {
+		task := models.Task{Name: "task " + folder, Schedule: "@hourly", Command: "echo hi", Enabled: true, Folder: folder}
+		if err := api.Store.CreateTask(&task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		ids = append(ids, task.ID)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/bulk-disable", bytes.NewBufferString(`{"folder":"team-a"}`))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if fmt.Sprint(body.IDs) != fmt.Sprint(ids[:2]) {
+		t.Fatalf("expected ids %v, got %v", ids[:2], body.IDs)
+	}
+	for i, id := range ids {
+		task, err := api.Store.GetTaskByID(id)
+		if err != nil {
+			t.Fatalf("failed to load task: %v", err)
+		}
+		if task.Enabled != (i >= 2) {
+			t.Fatalf("task %q: unexpected enabled=%v", task.Folder, task.Enabled)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/bulk-enable", bytes.NewBufferString(`{}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without a filter, got %d", rec.Code)
+	}
+}
+
+func TestSchedulerStatusCountsReloads(t *testing.T) {
+	api := newTestAPI(t)
+
+	status := func() engine.SchedulerStatus {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/scheduler/status", nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var s engine.SchedulerStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+		return s
+	}
+
+	before := status()
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"fresh","schedule":"@hourly","command":"echo hi","enabled":true}`))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	after := status()
+	if after.ReloadCount != before.ReloadCount+1 || after.LastReload.IsZero() {
+		t.Fatalf("expected create to reload once, before=%+v after=%+v", before, after)
+	}
+	if after.ScheduledTasks != 1 {
+		t.Fatalf("expected 1 scheduled task, got %d", after.ScheduledTasks)
+	}
+}
+
+func TestCreateTaskRejectsEmptyCommand(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"blank","schedule":"* * * * *","command":"   ","enabled":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	// Disabled tasks may be saved as placeholders without a command.
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"placeholder","schedule":"* * * * *","command":"","enabled":false}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for placeholder task, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateTaskRejectsRelativeCommandFile(t *testing.T) {
+	api := newTestAPI(t)
+	script := filepath.Join(t.TempDir(), "job.sh")
+	if err := os.WriteFile(script, []byte("echo hi\n"), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	for path, want := range map[string]int{
+		"job.sh": http.StatusBadRequest,
+		script:   http.StatusOK,
+	} {
+		body, _ := json.Marshal(map[string]interface{}{"name": "scripted", "schedule": "@daily", "command_file": path, "enabled": true})
+		req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("command_file %q: expected status %d, got %d, body=%s", path, want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCreateTaskRejectsUnknownExecutorCommand(t *testing.T) {
+	api := newTestAPI(t)
+
+	for command, want := range map[string]int{
+		"builtin://cleanpu": http.StatusBadRequest,
+		"plugin://job":      http.StatusBadRequest,
+		"builtin://cleanup": http.StatusOK,
+	} {
+		body, _ := json.Marshal(map[string]interface{}{"name": "maintenance", "schedule": "@daily", "command": command, "enabled": true})
+		req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("command %q: expected status %d, got %d, body=%s", command, want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestExportRunsJSONL(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := api.Engine.RunTaskSync(task.ID); err != nil {
+			t.Fatalf("failed to run task: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/runs/export?task_id=%d", task.ID), nil)
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(rec.Body.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSONL lines, got %d: %q", len(lines), rec.Body.String())
+	}
+	for _, line := range lines {
+		var run models.Run
+		if err := json.Unmarshal(line, &run); err != nil {
+			t.Fatalf("failed to decode line %q: %v", line, err)
+		}
+		if run.TaskID != task.ID {
+			t.Fatalf("expected task_id %d, got %d", task.ID, run.TaskID)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/runs/export?task_id=%d", task.ID+1), nil)
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected no runs for other task, got %q", rec.Body.String())
+	}
+}
+
+func TestSnoozeTaskAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/tasks/%d/snooze", task.ID), bytes.NewBufferString(`{"duration":"2h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	updated, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to read updated task: %v", err)
+	}
+	if !updated.Enabled {
+		t.Fatalf("expected snoozed task to stay enabled")
+	}
+	if until := time.Until(updated.PausedUntil); until < time.Hour || until > 2*time.Hour {
+		t.Fatalf("expected paused_until about 2h from now, got %s", updated.PausedUntil)
+	}
+}
+
+func TestTriggerTaskViaToken(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+	if task.TriggerToken == "" {
+		t.Fatalf("expected trigger token to be generated on create")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/triggers/"+task.TriggerToken, nil)
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	waitForRuns(t, api, task.ID)
+
+	updated, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to read updated task: %v", err)
+	}
+	if updated.LastRun.IsZero() {
+		t.Fatalf("expected last_run to be updated by trigger")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/triggers/wrong", nil)
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for unknown token, got %d", rec.Code)
+	}
+
+	updated.Enabled = false
+	if err := api.Store.UpdateTask(updated); err != nil {
+		t.Fatalf("failed to disable task: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/triggers/"+task.TriggerToken, nil)
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a disabled task, got %d", rec.Code)
+	}
+	if runs, _ := api.Store.GetRuns(task.ID); len(runs) != 1 {
+		t.Fatalf("expected no run for a disabled task, got %d runs", len(runs))
+	}
+}
+
+func TestPreviewTask(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/preview", bytes.NewBufferString(`{"name":"ok","schedule":"0 * * * *","command":"echo hi","enabled":true}`))
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var preview struct {
+		Valid    bool        `json:"valid"`
+		Errors   []string    `json:"errors"`
+		NextRuns []time.Time `json:"next_runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("failed to decode preview: %v", err)
+	}
+	if !preview.Valid || len(preview.Errors) != 0 {
+		t.Fatalf("expected valid preview, got %+v", preview)
+	}
+	if len(preview.NextRuns) != 5 || preview.NextRuns[0].Minute() != 0 {
+		t.Fatalf("expected 5 hourly next runs, got %v", preview.NextRuns)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/preview", bytes.NewBufferString(`{"name":"","schedule":"not a cron","command":"","enabled":true}`))
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("failed to decode preview: %v", err)
+	}
+	if preview.Valid || len(preview.Errors) != 3 {
+		t.Fatalf("expected 3 validation errors, got %+v", preview)
+	}
+
+	// Each of several schedules is checked on its own, and next runs merge
+	// all of them.
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/preview", bytes.NewBufferString(`{"name":"ok","schedules":["0 9 * * *","0 17 * * *"],"command":"echo hi","enabled":true}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	preview.Errors = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("failed to decode preview: %v", err)
+	}
+	if !preview.Valid || len(preview.NextRuns) != 5 || preview.NextRuns[0].Hour() == preview.NextRuns[1].Hour() {
+		t.Fatalf("expected a valid preview alternating between 9:00 and 17:00, got %+v", preview)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/preview", bytes.NewBufferString(`{"name":"ok","schedules":["0 9 * * *","bogus"],"command":"echo hi","enabled":true}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("failed to decode preview: %v", err)
+	}
+	if preview.Valid || len(preview.Errors) != 1 || !strings.HasPrefix(preview.Errors[0], `invalid schedules[1] "bogus"`) {
+		t.Fatalf("expected only the bad expression to be reported, got %+v", preview)
+	}
+
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("expected preview not to persist tasks, got %d", len(tasks))
+	}
+}
+
+func TestListBrokenTasks(t *testing.T) {
+	api := newTestAPI(t)
+	seedTask(t, api)
+
+	// Bypass API validation to simulate a task saved before schedules were checked.
+	bad := models.Task{Name: "bad", Schedule: "bogus", Command: "echo bad", Enabled: true}
+	if err := api.Store.CreateTask(&bad); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	api.Engine.Reload()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks?broken=true", nil)
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var tasks []models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("failed to decode tasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != bad.ID {
+		t.Fatalf("expected only the broken task, got %+v", tasks)
+	}
+	if tasks[0].LastScheduleOK || tasks[0].ScheduleError == "" {
+		t.Fatalf("expected schedule error to be recorded, got %+v", tasks[0])
+	}
+}
+
+func TestLogSizeAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logsDir, fmt.Sprintf("task_%d.log", task.ID)), []byte("12345"), 0644); err != nil {
+		t.Fatalf("failed to write legacy log: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logsDir, fmt.Sprintf("task_%d_20260212.log", task.ID)), []byte("1234567"), 0644); err != nil {
+		t.Fatalf("failed to write daily log: %v", err)
+	}
+	// Another task's log must not be counted.
+	if err := os.WriteFile(filepath.Join(logsDir, fmt.Sprintf("task_%d0_20260212.log", task.ID)), []byte("ignored"), 0644); err != nil {
+		t.Fatalf("failed to write other log: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs/size", task.ID), nil)
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	var size struct {
+		LogBytes int64 `json:"log_bytes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &size); err != nil {
+		t.Fatalf("failed to decode size: %v", err)
+	}
+	if size.LogBytes != 12 {
+		t.Fatalf("expected 12 log bytes, got %d", size.LogBytes)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d", task.ID), nil)
+	rec = httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &size); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if size.LogBytes != 12 {
+		t.Fatalf("expected task log_bytes 12, got %d", size.LogBytes)
+	}
+}
+
+func TestListTasksETag(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d and %q", rec.Code, etag)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", rec.Code)
+	}
+
+	task.Name = "renamed"
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 after change, got %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatalf("expected ETag to change after update")
+	}
+}
+
+func TestMCPInitializeNegotiatesProtocolVersion(t *testing.T) {
+	api := newTestAPI(t)
+
+	// initialize returns the negotiated version, or the JSON-RPC error code.
+	initialize := func(version string) (string, int) {
+		t.Helper()
+		body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + version + `"}}`
+		req := httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		var resp struct {
+			Result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			} `json:"result"`
+			Error struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v, body=%s", err, rec.Body.String())
+		}
+		return resp.Result.ProtocolVersion, resp.Error.Code
+	}
+
+	for requested, want := range map[string]string{
+		"2024-11-05": "2024-11-05",
+		"2025-03-26": "2025-03-26",
+		"2099-01-01": mcpProtocolVersions[len(mcpProtocolVersions)-1],
+		"":           "2024-11-05",
+	} {
+		if got, code := initialize(requested); code != 0 || got != want {
+			t.Errorf("requested %q: expected %q, got %q (error code %d)", requested, want, got, code)
+		}
+	}
+	for _, requested := range []string{"2023-01-01", "v1"} {
+		if _, code := initialize(requested); code != -32602 {
+			t.Errorf("requested %q: expected error code -32602, got %d", requested, code)
+		}
+	}
+}
+
+func TestMCPRunTaskStreamsProgress(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"run_task","arguments":{"id":%d},"_meta":{"progressToken":"tok-1"}}}`, task.ID)
+	req := httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q, body=%s", ct, rec.Body.String())
+	}
+	var messages []map[string]interface{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var msg map[string]interface{}
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				t.Fatalf("invalid event %q: %v", data, err)
+			}
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) < 2 {
+		t.Fatalf("expected progress and a result, got %s", rec.Body.String())
+	}
+	var output string
+	for _, msg := range messages[:len(messages)-1] {
+		params, _ := msg["params"].(map[string]interface{})
+		if msg["method"] != "notifications/progress" || params["progressToken"] != "tok-1" {
+			t.Fatalf("unexpected progress message %v", msg)
+		}
+		output += params["message"].(string)
+	}
+	if !strings.Contains(output, "before") {
+		t.Fatalf("expected streamed output, got %q", output)
+	}
+	final := messages[len(messages)-1]
+	if final["id"] != float64(7) || final["result"] == nil {
+		t.Fatalf("expected the tools/call result last, got %v", final)
+	}
+}
+
+func TestNotificationTestEndpoint(t *testing.T) {
+	api := newTestAPI(t)
+
+	var received engine.Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("not a webhook"))
+	}))
+	defer srv.Close()
+
+	task := seedTask(t, api)
+	task.NotifyURL = srv.URL
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications/test", bytes.NewBufferString(fmt.Sprintf(`{"task_id":%d}`, task.ID)))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var result engine.NotificationTestResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if result.StatusCode != http.StatusTeapot || result.Body != "not a webhook" {
+		t.Fatalf("expected the target's response, got %+v", result)
+	}
+	if !received.Test || received.TaskID != task.ID {
+		t.Fatalf("expected a test payload for the task, got %+v", received)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/notifications/test", bytes.NewBufferString(`{"url":"http://127.0.0.1:1/unreachable"}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502 for an unreachable target, got %d", rec.Code)
+	}
+}
+
+func callMCPTool(t *testing.T, api *API, name string, args map[string]interface{}) string {
+	t.Helper()
+
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]interface{}{
+			"name":      name,
+			"arguments": args,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Result struct {
+			IsError bool `json:"isError"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode MCP response: %v", err)
+	}
+	if resp.Result.IsError || len(resp.Result.Content) == 0 {
+		t.Fatalf("unexpected MCP result: %s", rec.Body.String())
+	}
+	return resp.Result.Content[0].Text
+}
+
+func TestCreateTaskWithOnlyOtherOSCommand(t *testing.T) {
+	api := newTestAPI(t)
+
+	other := `"command_windows":"cmd /c echo hi"`
+	if runtime.GOOS == "windows" {
+		other = `"command_unix":"echo hi"`
+	}
+	create := func(enabled bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"name":"other os only","schedule":"@daily",%s,"enabled":%t}`, other, enabled)
+		req := httptest.NewRequest(http.MethodPost, "/api/tasks", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// It could never run here, so it may only be saved disabled.
+	if rec := create(true); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), runtime.GOOS) {
+		t.Fatalf("expected status 400 naming the platform for an enabled task, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := create(false); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for a disabled task, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateTaskViaMCPWithPlatformCommand(t *testing.T) {
+	api := newTestAPI(t)
+
+	field, command := "command_unix", "echo hi"
+	if runtime.GOOS == "windows" {
+		field, command = "command_windows", "cmd /c echo hi"
+	}
+	callMCPTool(t, api, "create_task", map[string]interface{}{
+		"name":     "platform only",
+		"schedule": "@daily",
+		field:      command,
+	})
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+	if len(tasks) != 1 || engine.PlatformCommand(tasks[0], runtime.GOOS) != command || tasks[0].Command != "" {
+		t.Fatalf("expected the platform-only task, got %+v", tasks)
+	}
+}
+
+func TestDryRunPersistsNothing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	marker := filepath.Join(t.TempDir(), "ran")
+	task.Command = "touch " + marker
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+	before, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to read task: %v", err)
+	}
+
+	assertUntouched := func(via string) {
+		t.Helper()
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected the command not to run, got %v", via, err)
+		}
+		if runs, err := api.Store.GetRuns(task.ID); err != nil || len(runs) != 0 {
+			t.Fatalf("%s: expected no runs to be recorded, got %+v, %v", via, runs, err)
+		}
+		if size := engine.LogBytes(api.DataDir, task.ID); size != 0 {
+			t.Fatalf("%s: expected no logs to be written, got %d bytes", via, size)
+		}
+		after, err := api.Store.GetTaskByID(task.ID)
+		if err != nil {
+			t.Fatalf("%s: failed to read task: %v", via, err)
+		}
+		if after.Version != before.Version || !after.LastRun.Equal(before.LastRun) || after.LastError != before.LastError {
+			t.Fatalf("%s: expected the task to be unchanged, got %+v", via, after)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/tasks/%d/run?dry=true", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	var result engine.DryRunResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected a dry run result, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(result.Commands) != 1 || result.Commands[0] != task.Command {
+		t.Fatalf("expected the resolved command, got %+v", result)
+	}
+	assertUntouched("?dry=true")
+
+	text := callMCPTool(t, api, "run_task", map[string]interface{}{"id": task.ID, "dry_run": true})
+	if !strings.Contains(text, marker) {
+		t.Fatalf("expected the MCP dry run to report the command, got %q", text)
+	}
+	assertUntouched("dry_run")
+}
+
+func waitForRuns(t *testing.T, api *API, taskID int) []models.Run {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		runs, err := api.Store.GetRuns(taskID)
+		if err != nil {
+			t.Fatalf("failed to read runs: %v", err)
+		}
+		if len(runs) > 0 && runs[0].Status != models.RunStatusRunning {
+			return runs
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for task %d to finish", taskID)
+	return nil
+}
+
+func TestRunTaskViaMCPAsync(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task command: %v", err)
+	}
+
+	text := callMCPTool(t, api, "run_task", map[string]interface{}{"id": task.ID})
+	runs := waitForRuns(t, api, task.ID)
+	if want := fmt.Sprintf("started as run #%d", runs[0].ID); !bytes.Contains([]byte(text), []byte(want)) {
+		t.Fatalf("expected response to contain %q, got %q", want, text)
+	}
+
+	text = callMCPTool(t, api, "get_task_runs", map[string]interface{}{"id": task.ID})
+	var polled []models.Run
+	if err := json.Unmarshal([]byte(text), &polled); err != nil {
+		t.Fatalf("failed to decode runs: %v", err)
+	}
+	if len(polled) != 1 || polled[0].Status != models.RunStatusSuccess {
+		t.Fatalf("expected one successful run, got %+v", polled)
+	}
+}
+
+func TestUpcomingTasks(t *testing.T) {
+	now := time.Date(2026, 2, 12, 10, 30, 0, 0, time.Local)
+	tasks := []models.Task{
+		{ID: 1, Schedule: "0 * * * *", Enabled: true},
+		{ID: 2, Schedule: "45 10 * * *", Enabled: true},
+		{ID: 3, Schedule: "* * * * *", Enabled: false},
+		{ID: 4, Schedule: "0 0 * * *", Enabled: true},
+		{ID: 5, Schedule: "* * * * *", Enabled: true, PausedUntil: now.Add(2 * time.Hour)},
+	}
+
+	upcoming := upcomingTasks(tasks, now, time.Hour)
+	if len(upcoming) != 2 {
+		t.Fatalf("expected 2 upcoming tasks, got %+v", upcoming)
+	}
+	if upcoming[0].ID != 2 || upcoming[1].ID != 1 {
+		t.Fatalf("expected tasks sorted by next run (2, 1), got %d, %d", upcoming[0].ID, upcoming[1].ID)
+	}
+	if want := now.Add(15 * time.Minute); !upcoming[0].NextRun.Equal(want) {
+		t.Fatalf("expected next run %s, got %s", want, upcoming[0].NextRun)
+	}
+}
+
+func TestLogFilesAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	dailyName := fmt.Sprintf("task_%d_20260212.log", task.ID)
+	if err := os.WriteFile(filepath.Join(logsDir, fmt.Sprintf("task_%d.log", task.ID)), []byte("legacy\n"), 0644); err != nil {
+		t.Fatalf("failed to write legacy log: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logsDir, dailyName), []byte("daily\n"), 0644); err != nil {
+		t.Fatalf("failed to write daily log: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs/files", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var files []engine.LogFileInfo
+	if err := json.NewDecoder(rec.Body).Decode(&files); err != nil {
+		t.Fatalf("failed to decode files: %v", err)
+	}
+	if len(files) != 2 || files[1].Name != dailyName || files[1].Date != "2026-02-12" || files[1].Size != 6 {
+		t.Fatalf("unexpected log files: %+v", files)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs?file=%s", task.ID, dailyName), nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "daily\n" {
+		t.Fatalf("expected only the daily log, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs?file=../opencron.db", task.ID), nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a foreign file, got %d", rec.Code)
+	}
+}
+
+func TestCreateTaskQuota(t *testing.T) {
+	api := newTestAPI(t)
+	api.MaxTasks = 1
+	task := seedTask(t, api)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"extra","schedule":"* * * * *","command":"echo hi","enabled":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 at the quota, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	// Existing tasks remain editable at the cap.
+	req = httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(`{"name":"renamed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 when editing at the quota, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListTasksSorted(t *testing.T) {
+	api := newTestAPI(t)
+	for _, task := range []models.Task{
+		{Name: "bravo", Schedule: "0 0 1 1 *", Command: "echo b", Enabled: true, SortOrder: 2},
+		{Name: "alpha", Schedule: "* * * * *", Command: "echo a", Enabled: true, SortOrder: 3},
+		{Name: "charlie", Schedule: "0 * * * *", Command: "echo c", Enabled: false, SortOrder: 1},
+	} {
+		task := task
+		if err := api.Store.CreateTask(&task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	cases := map[string][]string{
+		"":              {"charlie", "bravo", "alpha"},
+		"?sort=name":    {"alpha", "bravo", "charlie"},
+		"?sort=created": {"bravo", "alpha", "charlie"},
+		// Disabled tasks never fire, so they sort last.
+		"?sort=next_run": {"alpha", "bravo", "charlie"},
+	}
+	for query, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks"+query, nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d", query, rec.Code)
+		}
+		var tasks []models.Task
+		if err := json.NewDecoder(rec.Body).Decode(&tasks); err != nil {
+			t.Fatalf("%q: failed to decode tasks: %v", query, err)
+		}
+		var got []string
+		for _, task := range tasks {
+			got = append(got, task.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%q: expected order %v, got %v", query, want, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks?sort=bogus", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for unknown sort, got %d", rec.Code)
+	}
+}
+
+func TestGetLogsDownloadAndJSON(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	name := fmt.Sprintf("task_%d_20260212.log", task.ID)
+	if err := os.WriteFile(filepath.Join(logsDir, name), []byte("daily\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs?download=true", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	want := fmt.Sprintf(`attachment; filename="task_%d_logs.txt"`, task.ID)
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Fatalf("expected Content-Disposition %q, got %q", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs", task.ID), nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	var body struct {
+		TaskID int              `json:"task_id"`
+		Files  []logFileContent `json:"files"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	if body.TaskID != task.ID || len(body.Files) != 1 || body.Files[0].Name != name || body.Files[0].Content != "daily\n" {
+		t.Fatalf("unexpected JSON logs: %+v", body)
+	}
+}
+
+func TestSearchLogs(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	for name, content := range map[string]string{
+		fmt.Sprintf("task_%d_20260211.log", task.ID):   "ok\nERROR: disk full\n",
+		fmt.Sprintf("task_%d_20260212.log", task.ID):   "fine\nstill fine\nan error again",
+		fmt.Sprintf("task_%d_20260212.log", task.ID+1): "error in another task\n",
+	} {
+		if err := os.WriteFile(filepath.Join(logsDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+
+	search := func(query string) []engine.LogMatch {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs/search?%s", task.ID, query), nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		matches := []engine.LogMatch{}
+		dec := json.NewDecoder(rec.Body)
+		for dec.More() {
+			var m engine.LogMatch
+			if err := dec.Decode(&m); err != nil {
+				t.Fatalf("failed to decode match: %v", err)
+			}
+			matches = append(matches, m)
+		}
+		return matches
+	}
+
+	if got := search("q=error"); len(got) != 1 || got[0].File != fmt.Sprintf("task_%d_20260212.log", task.ID) || got[0].Line != 3 || got[0].Text != "an error again" {
+		t.Fatalf("unexpected case-sensitive matches: %+v", got)
+	}
+	got := search("q=error&case_insensitive")
+	if len(got) != 2 || got[0].Line != 2 || got[0].Text != "ERROR: disk full" {
+		t.Fatalf("unexpected case-insensitive matches: %+v", got)
+	}
+	if got := search("q=error&case_insensitive=true&limit=1"); len(got) != 1 {
+		t.Fatalf("expected the limit to stop the search, got %+v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs/search", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without q, got %d", rec.Code)
+	}
+}
+
+func TestGetLogsOutputFormat(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.OutputFormat = models.OutputFormatJSON
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	name := fmt.Sprintf("task_%d_20260212.log", task.ID)
+	if err := os.WriteFile(filepath.Join(logsDir, name), []byte("--- Run #1 ---\n{\"ok\":true}\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	get := func(query string) (string, string) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/logs%s", task.ID, query), nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		var body struct {
+			OutputFormat string           `json:"output_format"`
+			Files        []logFileContent `json:"files"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode logs: %v", err)
+		}
+		if len(body.Files) != 1 {
+			t.Fatalf("expected one log file, got %+v", body)
+		}
+		return body.OutputFormat, body.Files[0].Content
+	}
+
+	format, content := get("")
+	if format != models.OutputFormatJSON || content != "--- Run #1 ---\n{\"ok\":true}\n" {
+		t.Fatalf("unexpected logs: format %q, content %q", format, content)
+	}
+	if _, content := get("?pretty=true"); content != "--- Run #1 ---\n{\n  \"ok\": true\n}\n" {
+		t.Fatalf("expected pretty-printed JSON, got %q", content)
+	}
+
+	task.OutputFormat = "html"
+	if err := api.validateTask(&task); err == nil {
+		t.Fatal("expected unknown output_format to be rejected")
+	}
+}
+
+func TestUpdateTaskIfMatch(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag for version 1, got %q", etag)
+	}
+
+	patch := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := patch(etag, `{"name":"first"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	// A second writer holding the stale version loses.
+	if rec := patch(etag, `{"name":"second"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status 412 for a stale version, got %d", rec.Code)
+	}
+
+	updated, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if updated.Name != "first" || updated.Version != 2 {
+		t.Fatalf("expected first update at version 2, got %q at %d", updated.Name, updated.Version)
+	}
+}
+
+func TestDeleteLogsAPI(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	for _, name := range []string{fmt.Sprintf("task_%d.log", task.ID), fmt.Sprintf("task_%d_20260212.log", task.ID)} {
+		if err := os.WriteFile(filepath.Join(logsDir, name), []byte("secret\n"), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+	// Another task's log must survive.
+	otherLog := filepath.Join(logsDir, fmt.Sprintf("task_%d0_20260212.log", task.ID))
+	if err := os.WriteFile(otherLog, []byte("other\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/tasks/%d/logs", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var body map[string]int
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body["deleted"] != 2 {
+		t.Fatalf("expected 2 deleted files, got %v", body)
+	}
+	if remaining := engine.LogFiles(api.DataDir, task.ID); len(remaining) != 0 {
+		t.Fatalf("expected no logs left, got %v", remaining)
+	}
+	if _, err := os.Stat(otherLog); err != nil {
+		t.Fatalf("expected other task's log to remain: %v", err)
+	}
+	if _, err := api.Store.GetTaskByID(task.ID); err != nil {
+		t.Fatalf("expected task to remain after clearing logs: %v", err)
+	}
+}
+
+func TestImportTasksPreserveIDs(t *testing.T) {
+	api := newTestAPI(t)
+	existing := seedTask(t, api)
+
+	body := fmt.Sprintf(`{"preserve_ids":true,"tasks":[
+		{"id":%d,"name":"clash","schedule":"* * * * *","command":"echo a","enabled":true},
+		{"id":42,"name":"kept","schedule":"* * * * *","command":"echo b","enabled":true}
+	]}`, existing.ID)
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Imported int            `json:"imported"`
+		IDMap    map[string]int `json:"id_map"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Imported != 2 {
+		t.Fatalf("expected 2 imported tasks, got %d", resp.Imported)
+	}
+	if _, ok := resp.IDMap["42"]; ok || len(resp.IDMap) != 1 {
+		t.Fatalf("expected only the clashing id to be remapped, got %v", resp.IDMap)
+	}
+
+	kept, err := api.Store.GetTaskByID(42)
+	if err != nil || kept.Name != "kept" {
+		t.Fatalf("expected task 42 to keep its id, got %+v, %v", kept, err)
+	}
+	moved, err := api.Store.GetTaskByID(resp.IDMap[strconv.Itoa(existing.ID)])
+	if err != nil || moved.Name != "clash" {
+		t.Fatalf("expected clashing task under its new id, got %+v, %v", moved, err)
+	}
+}
+
+func TestImportTasksReportsEveryInvalidEntry(t *testing.T) {
+	api := newTestAPI(t)
+
+	body := `{"tasks":[
+		{"name":"bad","schedule":"61 * * * *","command":"echo a","enabled":true},
+		{"name":"good","schedule":"* * * * *","command":"echo b","enabled":true},
+		{"name":"worse","schedules":["@daily","not a schedule"],"command":"echo c","enabled":true}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/import", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Errors []store.ImportTaskError `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Errors) != 2 || resp.Errors[0].Index != 0 || resp.Errors[1].Index != 2 || resp.Errors[1].Name != "worse" {
+		t.Fatalf("expected entries 0 and 2 to be reported, got %+v", resp.Errors)
+	}
+	if len(resp.Errors[1].Errors) != 1 || !strings.Contains(resp.Errors[1].Errors[0], "schedules[1]") {
+		t.Fatalf("expected the bad schedules entry to be named, got %v", resp.Errors[1].Errors)
+	}
+
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("expected nothing to be imported, got %d tasks", len(tasks))
+	}
+}
+
+func TestImportTasksRejectsDuplicateIDs(t *testing.T) {
+	api := newTestAPI(t)
+
+	tasks := `[
+		{"id":7,"name":"first","schedule":"@daily","command":"echo a","enabled":true},
+		{"id":8,"name":"other","schedule":"@daily","command":"echo b","enabled":true},
+		{"id":7,"name":"second","schedule":"@daily","command":"echo c","enabled":true}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/import", bytes.NewBufferString(`{"preserve_ids":true,"tasks":`+tasks+`}`))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Errors []store.ImportTaskError `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Index != 2 || len(resp.Errors[0].Errors) != 1 || !strings.Contains(resp.Errors[0].Errors[0], "duplicate id 7") {
+		t.Fatalf("expected the duplicate id to be named, got %+v", resp.Errors)
+	}
+	if stored, err := api.Store.GetTasks(); err != nil || len(stored) != 0 {
+		t.Fatalf("expected nothing to be imported, got %d tasks, %v", len(stored), err)
+	}
+
+	// Without preserve_ids the ids are ignored, so repeats are fine.
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/import", bytes.NewBufferString(`{"tasks":`+tasks+`}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 without preserve_ids, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if stored, err := api.Store.GetTasks(); err != nil || len(stored) != 3 {
+		t.Fatalf("expected 3 imported tasks, got %d, %v", len(stored), err)
+	}
+}
+
+func TestHealthzHeartbeat(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 without heartbeat, got %d", rec.Code)
+	}
+
+	api.Engine.StartHeartbeat()
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "last_heartbeat") {
+		t.Fatalf("expected healthy heartbeat, got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(api.DataDir, "heartbeat")); err != nil {
+		t.Fatalf("expected heartbeat file: %v", err)
+	}
+}
+
+func TestConfigAPI(t *testing.T) {
+	api := newTestAPI(t)
+	api.Config = Config{Port: "9090", LogRetentionHours: 24, APIKeySet: true}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var got map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if got["port"] != "9090" || got["api_key_set"] != true || got["log_retention_hours"] != float64(24) {
+		t.Fatalf("unexpected config: %v", got)
+	}
+	if _, ok := got["api_key"]; ok {
+		t.Fatalf("config must not expose the API key itself")
+	}
+}
+
+func TestCreateTaskRecordsCreator(t *testing.T) {
+	api := newTestAPI(t)
+	t.Setenv("API_KEYS", "ci=ci-secret,ops=ops-secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(`{"name":"labelled","schedule":"* * * * *","command":"echo hi","enabled":true,"created_by":"spoofed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "ops-secret")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var created models.Task
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	stored, err := api.Store.GetTaskByID(created.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if stored.CreatedBy != "ops" {
+		t.Fatalf("expected created_by ops, got %q", stored.CreatedBy)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 for an unknown key, got %d", rec.Code)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	api := newTestAPI(t)
+	api.MaxBodyBytes = 64
+
+	big := fmt.Sprintf(`{"name":"big","schedule":"* * * * *","command":"echo %s","enabled":true}`, strings.Repeat("x", 128))
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBufferString(big))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	// MCP has its own, larger cap.
+	req = httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewBufferString(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"pad":%q}}`, strings.Repeat("x", 128))))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected MCP request under its own limit to succeed, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/maintenance/on", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected maintenance on to succeed, got %d", rec.Code)
+	}
+	rec := do(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), `{"name":"blocked"}`)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do(http.MethodGet, "/api/tasks", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to continue, got %d", rec.Code)
+	}
+
+	// Callers without credentials are turned away before learning anything.
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(`{"name":"blocked"}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without an API key, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/triggers/wrong", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown trigger token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/triggers/"+task.TriggerToken, ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a trigger to be refused, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/mcp", fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_task","arguments":{"id":%d}}}`, task.ID))
+	if !strings.Contains(rec.Body.String(), `"isError":true`) || !strings.Contains(rec.Body.String(), "maintenance") {
+		t.Fatalf("expected MCP delete to be refused, got %s", rec.Body.String())
+	}
+
+	// The flag is persisted for the next start.
+	if value, err := api.Store.GetSetting("maintenance"); err != nil || value != "on" {
+		t.Fatalf("expected persisted maintenance flag, got %q, %v", value, err)
+	}
+
+	if rec := do(http.MethodPost, "/api/maintenance/off", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected maintenance off to succeed, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), `{"name":"allowed"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected updates after maintenance, got %d", rec.Code)
+	}
+}
+
+func TestMaintenanceModeAllowsReadOnlyPosts(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if err := api.Engine.SetMaintenance(true); err != nil {
+		t.Fatalf("failed to turn maintenance on: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		path string
+		body string
+	}{
+		{"preview", "/api/tasks/preview", `{"name":"new","schedule":"@daily","command":"echo hi"}`},
+		{"duplicate-check", "/api/tasks/duplicate-check", `{"name":"example"}`},
+		{"validate-command", fmt.Sprintf("/api/tasks/%d/validate-command", task.ID), ""},
+		{"dry run", fmt.Sprintf("/api/tasks/%d/run?dry=true", task.ID), ""},
+		{"notifications/test", "/api/notifications/test", fmt.Sprintf(`{"url":%q}`, srv.URL)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200 in maintenance mode, got %d, body=%s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// A real run is still refused.
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/tasks/%d/run", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a run to be refused, got %d", rec.Code)
+	}
+}
+
+func TestTaskMetadataRoundTrip(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(`{"metadata":{"ticket":"OPS-12","owners":["a@example.com"]}}`))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d", task.ID), nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	var got struct {
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if string(got.Metadata) != `{"ticket":"OPS-12","owners":["a@example.com"]}` {
+		t.Fatalf("expected metadata to round-trip, got %s", got.Metadata)
+	}
+
+	req = httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(`{"metadata":{"ticket":}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected malformed metadata to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestResetTaskFailures(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = "exit 1"
+	task.AutoDisableAfterFailures = 1
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if _, err := api.Engine.RunTaskSync(task.ID); err == nil {
+		t.Fatalf("expected the run to fail")
+	}
+	failed, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to read task: %v", err)
+	}
+	if failed.Enabled || !failed.AutoDisabled || failed.LastError == "" {
+		t.Fatalf("expected the failure to auto-disable the task, got %+v", failed)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/tasks/%d/reset", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var reset models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &reset); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if !reset.Enabled || reset.AutoDisabled || reset.LastError != "" {
+		t.Fatalf("expected reset to clear the error and re-enable, got %+v", reset)
+	}
+	if n, err := api.Store.ConsecutiveFailures(task.ID); err != nil || n != 0 {
+		t.Fatalf("expected the failure count to restart, got %d (%v)", n, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tasks/999/reset", nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a missing task, got %d", rec.Code)
+	}
+}
+
+func TestLockedTaskDeletion(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, fmt.Sprintf("/api/tasks/%d/lock", task.ID), "")
+	var locked models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &locked); err != nil || !locked.Locked {
+		t.Fatalf("expected a locked task, got %d %s", rec.Code, rec.Body.String())
+	}
+	// Updates leave the lock alone.
+	if rec := do(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), `{"name":"renamed","locked":false}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"locked":true`) {
+		t.Fatalf("expected the update to keep the lock, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodDelete, fmt.Sprintf("/api/tasks/%d", task.ID), ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 deleting a locked task, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/mcp", fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_task","arguments":{"id":%d}}}`, task.ID))
+	if !strings.Contains(rec.Body.String(), `"isError":true`) || !strings.Contains(rec.Body.String(), "locked") {
+		t.Fatalf("expected MCP delete to be refused, got %s", rec.Body.String())
+	}
+	if _, err := api.Store.GetTaskByID(task.ID); err != nil {
+		t.Fatalf("expected the locked task to survive: %v", err)
+	}
+
+	if rec := do(http.MethodDelete, fmt.Sprintf("/api/tasks/%d?force=true", task.ID), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a forced delete to succeed, got %d", rec.Code)
+	}
+
+	other := seedTask(t, api)
+	do(http.MethodPost, fmt.Sprintf("/api/tasks/%d/lock", other.ID), "")
+	if rec := do(http.MethodPost, fmt.Sprintf("/api/tasks/%d/unlock", other.ID), ""); !strings.Contains(rec.Body.String(), `"locked":false`) {
+		t.Fatalf("expected an unlocked task, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, fmt.Sprintf("/api/tasks/%d", other.ID), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected deleting an unlocked task to succeed, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/tasks/999/lock", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a missing task, got %d", rec.Code)
+	}
+}
+
+func TestTaskHistory(t *testing.T) {
+	api := newTestAPI(t)
+	t.Setenv("API_KEYS", "ops=ops-secret")
+	task := seedTask(t, api)
+
+	for _, body := range []string{`{"schedule":"0 * * * *"}`, `{"schedule":"0 * * * *"}`, `{"command":"echo after","enabled":false}`} {
+		req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", "ops-secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/history", task.ID), nil)
+	req.Header.Set("X-API-Key", "ops-secret")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var history []models.TaskChange
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	// The repeated edit changed nothing and is not recorded.
+	if len(history) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", history)
+	}
+	latest := history[0]
+	if latest.ChangedBy != "ops" || len(latest.Changes) != 2 {
+		t.Fatalf("unexpected latest change: %+v", latest)
+	}
+	if c := latest.Changes["command"]; string(c.Old) != `"echo before"` || string(c.New) != `"echo after"` {
+		t.Fatalf("unexpected command change: old=%s new=%s", c.Old, c.New)
+	}
+	if c := history[1].Changes["schedule"]; string(c.Old) != `"* * * * *"` || string(c.New) != `"0 * * * *"` {
+		t.Fatalf("unexpected schedule change: old=%s new=%s", c.Old, c.New)
+	}
+
+	stored, err := api.Store.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if stored.ModifiedBy != "ops" {
+		t.Fatalf("expected modified_by ops, got %q", stored.ModifiedBy)
+	}
+}
+
+func TestQueueListsRunningRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Command = "sleep 1"
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+
+	runID, done, err := api.Engine.RunTaskNow(task.ID)
+	if err != nil {
+		t.Fatalf("RunTaskNow failed: %v", err)
+	}
+	queue := func() engine.ExecutionQueue {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/queue", nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var q engine.ExecutionQueue
+		if err := json.Unmarshal(rec.Body.Bytes(), &q); err != nil {
+			t.Fatalf("failed to decode queue: %v", err)
+		}
+		return q
+	}
+
+	q := queue()
+	if len(q.Running) != 1 || q.Running[0].RunID != runID || q.Running[0].TaskID != task.ID || q.Running[0].TaskName != task.Name {
+		t.Fatalf("expected the run in progress, got %+v", q)
+	}
+	<-done
+	if q := queue(); len(q.Running) != 0 || q.Queued == nil {
+		t.Fatalf("expected an empty queue after the run, got %+v", q)
+	}
+}
+
+func TestSchedulerTickDevMode(t *testing.T) {
+	api := newTestAPI(t)
+	due := seedTask(t, api)
+	due.Command = runnableCommand()
+	if err := api.Store.UpdateTask(&due); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	yearly := models.Task{Name: "yearly", Schedule: "0 0 1 1 *", Command: runnableCommand(), Enabled: true}
+	if err := api.Store.CreateTask(&yearly); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	api.Engine.Reload()
+
+	tick := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/scheduler/tick?window=1m", nil)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := tick(); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without DEV_MODE, got %d", rec.Code)
+	}
+
+	api.DevMode = true
+	rec := tick()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var fired []engine.TickedTask
+	if err := json.Unmarshal(rec.Body.Bytes(), &fired); err != nil {
+		t.Fatalf("failed to decode tick: %v", err)
+	}
+	if len(fired) != 1 || fired[0].TaskID != due.ID {
+		t.Fatalf("expected only the every-minute task to fire, got %+v", fired)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runs, err := api.Store.GetRuns(due.ID)
+		if err != nil {
+			t.Fatalf("GetRuns failed: %v", err)
+		}
+		if len(runs) > 0 && !runs[0].FinishedAt.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the fired task to run, got %+v", runs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
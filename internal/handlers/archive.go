@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/opencron/opencron/internal/engine"
+	"github.com/opencron/opencron/internal/models"
+)
+
+// handleTaskArchive streams a .tar.gz holding the task's definition as
+// task.json and its log files under logs/.
+func (api *API) handleTaskArchive(w http.ResponseWriter, r *http.Request, idParam string) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	t, err := api.Store.GetTaskByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="task_%d_archive.tar.gz"`, id))
+	// Headers are already sent once streaming starts, so failures can only
+	// be logged; the client sees a truncated archive.
+	if err := writeTaskArchive(w, api.DataDir, t); err != nil {
+		log.Printf("Failed to write archive of task %d: %v", id, err)
+	}
+}
+
+func writeTaskArchive(w io.Writer, dataDir string, t *models.Task) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	definition, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    "task.json",
+		Mode:    0644,
+		Size:    int64(len(definition)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(definition); err != nil {
+		return err
+	}
+
+	for _, path := range engine.LogFiles(dataDir, t.ID) {
+		if err := addArchiveFile(tw, path, "logs/"+filepath.Base(path)); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addArchiveFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// Copy only the size recorded in the header in case the log is still
+	// being appended to.
+	_, err = io.CopyN(tw, f, header.Size)
+	return err
+}
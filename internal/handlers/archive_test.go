@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestTaskArchive(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+
+	logsDir := filepath.Join(api.DataDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("failed to create logs dir: %v", err)
+	}
+	logName := fmt.Sprintf("task_%d_20260212.log", task.ID)
+	if err := os.WriteFile(filepath.Join(logsDir, logName), []byte("daily\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/tasks/%d/archive", task.ID), nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("expected gzip body: %v", err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", header.Name, err)
+		}
+		files[header.Name] = content
+	}
+
+	var archived models.Task
+	if err := json.Unmarshal(files["task.json"], &archived); err != nil {
+		t.Fatalf("failed to decode task.json: %v", err)
+	}
+	if archived.ID != task.ID || archived.Command != task.Command {
+		t.Fatalf("unexpected archived task: %+v", archived)
+	}
+	if got := string(files["logs/"+logName]); got != "daily\n" {
+		t.Fatalf("expected archived log, got %q (files: %d)", got, len(files))
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/opencron/opencron/internal/engine"
+)
+
+// batchTaskResult is one task's outcome in a batch run.
+type batchTaskResult struct {
+	TaskID   int    `json:"task_id"`
+	TaskName string `json:"task_name"`
+	*engine.RunResult
+	// StartError is set instead of a result when the run could not start.
+	StartError string `json:"start_error,omitempty"`
+}
+
+// handleBatches serves POST /api/batches/{name}/run, which runs every enabled
+// task in the batch one after another, in sort_order then id order, and
+// reports each outcome. It responds once all of them have finished.
+func (api *API) handleBatches(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[3] != "run" || parts[2] == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := parts[2]
+
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := []batchTaskResult{}
+	success := true
+	for _, t := range tasks {
+		if t.Batch != name || !t.Enabled {
+			continue
+		}
+		res := batchTaskResult{TaskID: t.ID, TaskName: t.Name}
+		result, err := api.Engine.RunTaskSync(t.ID)
+		if result == nil {
+			res.StartError = err.Error()
+			success = false
+		} else {
+			res.RunResult = result
+			success = success && result.Success
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		http.Error(w, "No enabled tasks in batch", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"batch":   name,
+		"success": success,
+		"results": results,
+	})
+}
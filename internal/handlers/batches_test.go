@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestRunBatch(t *testing.T) {
+	api := newTestAPI(t)
+	for _, task := range []models.Task{
+		{Name: "load", Schedule: "@yearly", Command: "echo load", Enabled: true, Batch: "etl", SortOrder: 2},
+		{Name: "extract", Schedule: "@yearly", Command: "echo extract", Enabled: true, Batch: "etl", SortOrder: 1},
+		{Name: "broken", Schedule: "@yearly", Command: "exit 3", Enabled: true, Batch: "etl", SortOrder: 3},
+		{Name: "paused", Schedule: "@yearly", Command: "echo paused", Enabled: false, Batch: "etl"},
+		{Name: "other", Schedule: "@yearly", Command: "echo other", Enabled: true, Batch: "reports"},
+	} {
+		if err := api.Store.CreateTask(&task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/batches/etl/run", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Success bool `json:"success"`
+		Results []struct {
+			TaskName string `json:"task_name"`
+			Success  bool   `json:"success"`
+			ExitCode int    `json:"exit_code"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.Success {
+		t.Fatalf("expected the batch to fail because one task failed")
+	}
+	var names []string
+	for _, r := range body.Results {
+		names = append(names, r.TaskName)
+	}
+	if len(names) != 3 || names[0] != "extract" || names[1] != "load" || names[2] != "broken" {
+		t.Fatalf("expected enabled batch tasks in sort order, got %v", names)
+	}
+	if !body.Results[0].Success || body.Results[2].Success || body.Results[2].ExitCode != 3 {
+		t.Fatalf("unexpected per-task results: %+v", body.Results)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/batches/missing/run", nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for an empty batch, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// camelCaseRequested reports whether the client asked for camelCase field
+// names, with ?case=camel or an Accept header such as
+// "application/json; case=camel". MCP and the OpenAPI document describe
+// their own schemas and are never rewritten.
+func camelCaseRequested(r *http.Request) bool {
+	if r.URL.Path == "/mcp" || r.URL.Path == "/api/openapi.json" {
+		return false
+	}
+	if strings.EqualFold(r.URL.Query().Get("case"), "camel") {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && strings.EqualFold(params["case"], "camel") {
+			return true
+		}
+	}
+	return false
+}
+
+// camelCase turns a snake_case field name into camelCase: last_run becomes
+// lastRun. Names without underscores are returned unchanged.
+func camelCase(name string) string {
+	if !strings.Contains(name, "_") {
+		return name
+	}
+	var sb strings.Builder
+	upper := false
+	for i, c := range name {
+		if c == '_' && i > 0 {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// verbatimFields are fields whose values belong to the user and are returned
+// as stored, keys included.
+var verbatimFields = map[string]bool{"metadata": true}
+
+// camelCaseKeys renames the keys of every object within v, which was decoded
+// from JSON, with camelCase, leaving the values of verbatimFields alone.
+func camelCaseKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			if verbatimFields[key] {
+				out[key] = val
+				continue
+			}
+			out[camelCase(key)] = camelCaseKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range v {
+			v[i] = camelCaseKeys(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// camelCaseWriter buffers a JSON response so its field names can be
+// rewritten once the handler is done. Other responses, such as logs and
+// NDJSON streams, are passed through as they are written.
+type camelCaseWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	buffer  bool
+	body    bytes.Buffer
+}
+
+// decide picks buffering or passthrough from the Content-Type, which
+// handlers set before writing.
+func (c *camelCaseWriter) decide() {
+	if c.decided {
+		return
+	}
+	c.decided = true
+	mediaType, _, _ := mime.ParseMediaType(c.Header().Get("Content-Type"))
+	c.buffer = mediaType == "application/json"
+}
+
+func (c *camelCaseWriter) WriteHeader(code int) {
+	c.decide()
+	if c.buffer {
+		if c.status == 0 {
+			c.status = code
+		}
+		return
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *camelCaseWriter) Write(p []byte) (int, error) {
+	c.decide()
+	if c.buffer {
+		return c.body.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// passed-through streams.
+func (c *camelCaseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// finish writes a buffered response with its field names in camelCase. A
+// body that isn't valid JSON is sent unchanged.
+func (c *camelCaseWriter) finish() {
+	if !c.buffer {
+		return
+	}
+	body := c.body.Bytes()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		if out, err := json.Marshal(camelCaseKeys(v)); err == nil {
+			body = append(out, '\n')
+		}
+	}
+	c.Header().Del("Content-Length")
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+	c.ResponseWriter.Write(body)
+}
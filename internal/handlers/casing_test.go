@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCamelCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"last_run":                 "lastRun",
+		"id":                       "id",
+		"max_consecutive_failures": "maxConsecutiveFailures",
+		"_private":                 "_private",
+	} {
+		if got := camelCase(in); got != want {
+			t.Fatalf("camelCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCamelCaseResponses(t *testing.T) {
+	api := newTestAPI(t)
+	task := seedTask(t, api)
+	task.Metadata = json.RawMessage(`{"team_name":"infra"}`)
+	if err := api.Store.UpdateTask(&task); err != nil {
+		t.Fatalf("failed to set metadata: %v", err)
+	}
+
+	get := func(target string, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(fmt.Sprintf("/api/tasks/%d", task.ID), "")
+	if !strings.Contains(rec.Body.String(), `"last_run"`) {
+		t.Fatalf("expected snake_case by default, got %s", rec.Body.String())
+	}
+
+	rec = get(fmt.Sprintf("/api/tasks/%d?case=camel", task.ID), "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"last_run"`) {
+		t.Fatalf("expected camelCase fields, got %d %s", rec.Code, rec.Body.String())
+	}
+	var detail map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := detail["lastRun"]; !ok || detail["id"] != float64(task.ID) {
+		t.Fatalf("expected lastRun and id, got %v", detail)
+	}
+
+	// User-owned metadata is returned as stored.
+	if metadata, _ := detail["metadata"].(map[string]interface{}); metadata["team_name"] != "infra" {
+		t.Fatalf("expected metadata keys to be left alone, got %v", detail["metadata"])
+	}
+
+	rec = get("/api/tasks", "application/json; case=camel")
+	var tasks []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0]["createdAt"] == nil {
+		t.Fatalf("expected camelCase list entries, got %s", rec.Body.String())
+	}
+
+	// MCP tool schemas keep their property names.
+	req := httptest.NewRequest(http.MethodPost, "/mcp?case=camel", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"one_shot"`) {
+		t.Fatalf("expected MCP responses not to be rewritten, got %s", rec.Body.String())
+	}
+
+	// Errors are plain text and pass through unchanged.
+	rec = get("/api/tasks/999999?case=camel", "")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "Task not found") {
+		t.Fatalf("expected the usual 404, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// folderNode is one level of the folder tree. TaskCount includes tasks in
+// all nested folders.
+type folderNode struct {
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	TaskCount int           `json:"task_count"`
+	Children  []*folderNode `json:"children"`
+}
+
+// normalizeFolder cleans a path-like folder such as "/team-a//backups/" into
+// "team-a/backups". The root folder is the empty string.
+func normalizeFolder(folder string) string {
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	if folder == "" {
+		return ""
+	}
+	cleaned := path.Clean(folder)
+	if cleaned == "." {
+		return ""
+	}
+	return cleaned
+}
+
+// inFolder reports whether folder is prefix or nested below it.
+func inFolder(folder, prefix string) bool {
+	return prefix == "" || folder == prefix || strings.HasPrefix(folder, prefix+"/")
+}
+
+func filterTasksInFolder(tasks []models.Task, prefix string) []models.Task {
+	matched := []models.Task{}
+	for _, t := range tasks {
+		if inFolder(t.Folder, prefix) {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+func buildFolderTree(tasks []models.Task) *folderNode {
+	root := &folderNode{Children: []*folderNode{}}
+	for _, t := range tasks {
+		node := root
+		node.TaskCount++
+		if t.Folder == "" {
+			continue
+		}
+		for _, name := range strings.Split(t.Folder, "/") {
+			var child *folderNode
+			for _, c := range node.Children {
+				if c.Name == name {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				child = &folderNode{Name: name, Path: path.Join(node.Path, name), Children: []*folderNode{}}
+				node.Children = append(node.Children, child)
+			}
+			child.TaskCount++
+			node = child
+		}
+	}
+	sortFolderTree(root)
+	return root
+}
+
+func sortFolderTree(node *folderNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	for _, c := range node.Children {
+		sortFolderTree(c)
+	}
+}
+
+func (api *API) handleFolders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(buildFolderTree(tasks))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestFoldersAPI(t *testing.T) {
+	api := newTestAPI(t)
+	for _, folder := range []string{"team-a/backups", "team-a/backups", "team-a/reports", "team-ab", ""} {
+		task := models.Task{Name: "t", Schedule: "* * * * *", Command: "echo hi", Folder: folder}
+		if err := api.Store.CreateTask(&task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/folders", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var root folderNode
+	if err := json.Unmarshal(rec.Body.Bytes(), &root); err != nil {
+		t.Fatalf("failed to decode folders: %v", err)
+	}
+	if root.TaskCount != 5 || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	teamA := root.Children[0]
+	if teamA.Path != "team-a" || teamA.TaskCount != 3 || len(teamA.Children) != 2 {
+		t.Fatalf("unexpected team-a node: %+v", teamA)
+	}
+	if backups := teamA.Children[0]; backups.Path != "team-a/backups" || backups.TaskCount != 2 {
+		t.Fatalf("unexpected backups node: %+v", backups)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tasks?folder=/team-a/", nil)
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	var tasks []models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("failed to decode tasks: %v", err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 tasks under team-a (not team-ab), got %d", len(tasks))
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// progressWriter hands a run's output to the MCP handler in chunks. Once the
+// handler has stopped listening, output is dropped rather than blocking the
+// run.
+type progressWriter struct {
+	chunks chan<- []byte
+	stop   <-chan struct{}
+}
+
+func (pw progressWriter) Write(p []byte) (int, error) {
+	chunk := append([]byte(nil), p...)
+	select {
+	case pw.chunks <- chunk:
+	case <-pw.stop:
+	}
+	return len(p), nil
+}
+
+// streamRunProgress runs a task for an MCP run_task call that carried a
+// progressToken. The response becomes a server-sent event stream: one
+// notifications/progress message per chunk of output, whose progress is the
+// number of output bytes so far, followed by the tools/call result. Like
+// wait:true, it stops waiting after mcpRunWaitTimeout.
+func (api *API) streamRunProgress(w http.ResponseWriter, r *http.Request, reqID interface{}, taskID int, token interface{}) {
+	result := func(res map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": reqID, "result": res}
+	}
+	text := func(isError bool, format string, args ...interface{}) map[string]interface{} {
+		res := map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": fmt.Sprintf(format, args...)}},
+		}
+		if isError {
+			res["isError"] = true
+		}
+		return result(res)
+	}
+
+	chunks := make(chan []byte, 64)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	runID, done, err := api.Engine.RunTaskWithProgress(taskID, progressWriter{chunks: chunks, stop: stop})
+	if err != nil {
+		json.NewEncoder(w).Encode(text(true, "%s", err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	send := func(msg interface{}) {
+		data, _ := json.Marshal(msg)
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		rc.Flush()
+	}
+	var sent int
+	sendChunk := func(chunk []byte) {
+		sent += len(chunk)
+		send(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/progress",
+			"params": map[string]interface{}{
+				"progressToken": token,
+				"progress":      sent,
+				"message":       string(chunk),
+			},
+		})
+	}
+
+	timeout := time.After(mcpRunWaitTimeout)
+	for {
+		select {
+		case chunk := <-chunks:
+			sendChunk(chunk)
+		case res := <-done:
+			// All output was handed over before the run finished.
+			for len(chunks) > 0 {
+				sendChunk(<-chunks)
+			}
+			data, _ := json.Marshal(res)
+			if res.Err != nil {
+				send(text(true, "run #%d of task %d failed: %s", runID, taskID, data))
+				return
+			}
+			send(text(false, "Task %d executed as run #%d: %s", taskID, runID, data))
+			return
+		case <-timeout:
+			send(text(false, "Run #%d of task %d still running after %s; poll get_task_runs for the outcome", runID, taskID, mcpRunWaitTimeout))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
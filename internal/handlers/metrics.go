@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+// metricsLabelEscaper escapes label values for the Prometheus text format.
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// handleMetrics serves per-task gauges in the Prometheus text format. There
+// is one series per task and metric, so cardinality follows the task count.
+func (api *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tasks, err := api.Store.GetTasks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := api.Store.RunStats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# HELP opencron_task_last_success_timestamp Unix time the task's latest successful run finished; 0 if it never succeeded.\n")
+	sb.WriteString("# TYPE opencron_task_last_success_timestamp gauge\n")
+	for _, t := range tasks {
+		var ts int64
+		if last := stats[t.ID].LastSuccess; !last.IsZero() {
+			ts = last.Unix()
+		}
+		fmt.Fprintf(&sb, "opencron_task_last_success_timestamp{%s} %d\n", taskLabels(t), ts)
+	}
+	sb.WriteString("# HELP opencron_task_last_run_status Outcome of the task's latest finished run: 1 for success, 0 for failure.\n")
+	sb.WriteString("# TYPE opencron_task_last_run_status gauge\n")
+	for _, t := range tasks {
+		status := stats[t.ID].LastStatus
+		if status == "" {
+			continue
+		}
+		value := 0
+		if status == models.RunStatusSuccess {
+			value = 1
+		}
+		fmt.Fprintf(&sb, "opencron_task_last_run_status{%s} %d\n", taskLabels(t), value)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(sb.String()))
+}
+
+func taskLabels(t models.Task) string {
+	return fmt.Sprintf(`task_id="%d",task="%s"`, t.ID, metricsLabelEscaper.Replace(t.Name))
+}
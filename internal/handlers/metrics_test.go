@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestMetricsPerTaskGauges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh exit codes")
+	}
+	t.Setenv("API_KEY", "secret")
+	api := newTestAPI(t)
+	flaky := models.Task{Name: `say "hi"`, Schedule: "@hourly", Command: "echo ok"}
+	idle := models.Task{Name: "idle", Schedule: "@hourly", Command: "echo ok"}
+	for _, task := range []*models.Task{&flaky, &idle} {
+		if err := api.Store.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+	if _, err := api.Engine.RunTaskSync(flaky.ID); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	flaky.Command = "exit 1"
+	if err := api.Store.UpdateTask(&flaky); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	_, _ = api.Engine.RunTaskSync(flaky.ID)
+
+	// Task names and outcomes stay behind the API key like the rest of the
+	// API.
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without the API key, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("X-API-Key", "secret")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+
+	flakyLabels := fmt.Sprintf(`task_id="%d",task="say \"hi\""`, flaky.ID)
+	idleLabels := fmt.Sprintf(`task_id="%d",task="idle"`, idle.ID)
+	for _, want := range []string{
+		"opencron_task_last_run_status{" + flakyLabels + "} 0\n",
+		"opencron_task_last_success_timestamp{" + idleLabels + "} 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "opencron_task_last_success_timestamp{"+flakyLabels+"} 0\n") {
+		t.Errorf("expected a last success time for %s:\n%s", flaky.Name, body)
+	}
+	if strings.Contains(body, "opencron_task_last_run_status{"+idleLabels) {
+		t.Errorf("expected no run status for a task that never ran:\n%s", body)
+	}
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencron/opencron/internal/engine"
+	"github.com/opencron/opencron/internal/models"
+)
+
+// openAPISchemas are the request and response bodies described in the
+// OpenAPI document. Their schemas are generated from the structs themselves,
+// so new fields show up without editing the spec.
+var openAPISchemas = map[string]interface{}{
+	"Task":                   models.Task{},
+	"UpcomingTask":           upcomingTask{},
+	"BatchTaskResult":        batchTaskResult{},
+	"TaskDetail":             taskDetail{},
+	"TaskUpdate":             taskUpdateRequest{},
+	"TaskImport":             taskImportRequest{},
+	"BulkEnable":             bulkEnableRequest{},
+	"DuplicateCheck":         duplicateCheckRequest{},
+	"Run":                    models.Run{},
+	"TaskChange":             models.TaskChange{},
+	"RunResult":              engine.RunResult{},
+	"DryRunResult":           engine.DryRunResult{},
+	"CommandValidation":      commandValidation{},
+	"LogFileInfo":            engine.LogFileInfo{},
+	"LogMatch":               engine.LogMatch{},
+	"SchedulerStatus":        engine.SchedulerStatus{},
+	"ExecutionQueue":         engine.ExecutionQueue{},
+	"TickedTask":             engine.TickedTask{},
+	"NotificationTest":       notificationTestRequest{},
+	"NotificationTestResult": engine.NotificationTestResult{},
+	"Config":                 Config{},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIBody []byte
+)
+
+func (api *API) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	openAPIOnce.Do(func() {
+		openAPIBody, _ = json.Marshal(openAPIDocument())
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIBody)
+}
+
+// openAPIDocument builds the OpenAPI 3 description of the REST API. Paths are
+// listed by hand; schemas come from openAPISchemas.
+func openAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	for name, v := range openAPISchemas {
+		schemas[name] = jsonSchema(reflect.TypeOf(v))
+	}
+
+	ref := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	arrayOf := func(name string) map[string]interface{} {
+		return map[string]interface{}{"type": "array", "items": ref(name)}
+	}
+	jsonBody := func(schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}}
+	}
+	textBody := map[string]interface{}{"content": map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}}
+	op := func(summary string, response map[string]interface{}) map[string]interface{} {
+		ok := map[string]interface{}{"description": "OK"}
+		for k, v := range response {
+			ok[k] = v
+		}
+		return map[string]interface{}{"summary": summary, "responses": map[string]interface{}{"200": ok}}
+	}
+	withBody := func(operation map[string]interface{}, schema map[string]interface{}) map[string]interface{} {
+		operation["requestBody"] = jsonBody(schema)
+		return operation
+	}
+	idParam := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "integer"}}
+	}
+	stringParam := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}}
+	}
+	withParams := func(item map[string]interface{}, params ...map[string]interface{}) map[string]interface{} {
+		item["parameters"] = params
+		return item
+	}
+
+	// Trigger URLs authenticate with their own token, not the API key.
+	trigger := op("Start a run with a task's trigger token", nil)
+	trigger["security"] = []map[string]interface{}{}
+
+	paths := map[string]interface{}{
+		"/api/tasks": map[string]interface{}{
+			"get":  op("List tasks", jsonBody(arrayOf("Task"))),
+			"post": withBody(op("Create a task", jsonBody(ref("Task"))), ref("Task")),
+		},
+		"/api/tasks/import": map[string]interface{}{
+			"post": withBody(op("Create many tasks at once; if any entry is invalid, none are created and all are listed", nil), ref("TaskImport")),
+		},
+		"/api/tasks/bulk-enable": map[string]interface{}{
+			"post": withBody(op("Enable matching tasks", nil), ref("BulkEnable")),
+		},
+		"/api/tasks/bulk-disable": map[string]interface{}{
+			"post": withBody(op("Disable matching tasks", nil), ref("BulkEnable")),
+		},
+		"/api/tasks/upcoming": map[string]interface{}{
+			"get": op("List enabled tasks due within ?within (default 1h), soonest first", jsonBody(arrayOf("UpcomingTask"))),
+		},
+		"/api/tasks/preview": map[string]interface{}{
+			"post": withBody(op("Validate a task without saving it and list its next runs and similar tasks", nil), ref("Task")),
+		},
+		"/api/tasks/duplicate-check": map[string]interface{}{
+			"post": withBody(op("List existing tasks a new one would duplicate", jsonBody(arrayOf("Task"))), ref("DuplicateCheck")),
+		},
+		"/api/tasks/{id}/duplicate-check": withParams(map[string]interface{}{
+			"get": op("List other tasks that duplicate this one", jsonBody(arrayOf("Task"))),
+		}, idParam("id")),
+		"/api/tasks/{id}": withParams(map[string]interface{}{
+			"get":    op("Get a task", jsonBody(ref("TaskDetail"))),
+			"put":    withBody(op("Update a task", jsonBody(ref("Task"))), ref("TaskUpdate")),
+			"patch":  withBody(op("Partially update a task", jsonBody(ref("Task"))), ref("TaskUpdate")),
+			"delete": op("Delete a task; locked tasks need ?force=true", nil),
+		}, idParam("id")),
+		"/api/tasks/{id}/run": withParams(map[string]interface{}{
+			"post": op("Start a run; ?wait=true returns its result, ?dry=true only resolves it, a repeated dedup_key returns the earlier run", jsonBody(ref("RunResult"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/trigger-token": withParams(map[string]interface{}{
+			"post": op("Issue a new trigger token, replacing any previous one", nil),
+		}, idParam("id")),
+		"/api/tasks/{id}/snooze": withParams(map[string]interface{}{
+			"post": op("Pause a task's schedule for a {\"duration\"}; \"0s\" clears it", jsonBody(ref("Task"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/archive": withParams(map[string]interface{}{
+			"get": op("Download a .tar.gz of the task and its logs", map[string]interface{}{
+				"content": map[string]interface{}{"application/gzip": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+			}),
+		}, idParam("id")),
+		"/api/tasks/{id}/history": withParams(map[string]interface{}{
+			"get": op("List a task's recorded edits", jsonBody(arrayOf("TaskChange"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/reset": withParams(map[string]interface{}{
+			"post": op("Clear a task's failure state", jsonBody(ref("Task"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/lock": withParams(map[string]interface{}{
+			"post": op("Protect a task from deletion", jsonBody(ref("Task"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/unlock": withParams(map[string]interface{}{
+			"post": op("Allow a task to be deleted again", jsonBody(ref("Task"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/validate-command": withParams(map[string]interface{}{
+			"post": op("Split a task's resolved commands into arguments", jsonBody(ref("CommandValidation"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/runs": withParams(map[string]interface{}{
+			"get": op("List a task's runs", jsonBody(arrayOf("Run"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/runs/{run_id}/logs": withParams(map[string]interface{}{
+			"get": op("Get one run's output", textBody),
+		}, idParam("id"), idParam("run_id")),
+		"/api/tasks/{id}/logs": withParams(map[string]interface{}{
+			"get":    op("Get a task's logs", textBody),
+			"delete": op("Delete a task's logs", nil),
+		}, idParam("id")),
+		"/api/tasks/{id}/logs/search": withParams(map[string]interface{}{
+			"get": op("Search a task's log files for ?q; one LogMatch per line", map[string]interface{}{
+				"content": map[string]interface{}{"application/x-ndjson": map[string]interface{}{"schema": ref("LogMatch")}},
+			}),
+		}, idParam("id")),
+		"/api/tasks/{id}/logs/size": withParams(map[string]interface{}{
+			"get": op("Total size of a task's log files", nil),
+		}, idParam("id")),
+		"/api/tasks/{id}/logs/files": withParams(map[string]interface{}{
+			"get": op("List a task's log files", jsonBody(arrayOf("LogFileInfo"))),
+		}, idParam("id")),
+		"/api/tasks/{id}/schedule": withParams(map[string]interface{}{
+			"get": op("List a task's next fire times", nil),
+		}, idParam("id")),
+		"/api/scheduler/status": map[string]interface{}{
+			"get": op("Scheduler reload status", jsonBody(ref("SchedulerStatus"))),
+		},
+		"/api/scheduler/tick": map[string]interface{}{
+			"post": op("Start tasks due within ?window (DEV_MODE only)", jsonBody(arrayOf("TickedTask"))),
+		},
+		"/api/queue": map[string]interface{}{
+			"get": op("Runs in progress", jsonBody(ref("ExecutionQueue"))),
+		},
+		"/api/notifications/test": map[string]interface{}{
+			"post": withBody(op("Send a test notification", jsonBody(ref("NotificationTestResult"))), ref("NotificationTest")),
+		},
+		"/api/config": map[string]interface{}{
+			"get": op("Effective configuration", jsonBody(ref("Config"))),
+		},
+		"/api/maintenance/on": map[string]interface{}{
+			"post": op("Enter maintenance mode, refusing changes until it is turned off", nil),
+		},
+		"/api/maintenance/off": map[string]interface{}{
+			"post": op("Leave maintenance mode", nil),
+		},
+		"/api/batches/{name}/run": withParams(map[string]interface{}{
+			"post": op("Run a batch's enabled tasks one after another and report each result", jsonBody(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"batch":   map[string]interface{}{"type": "string"},
+					"success": map[string]interface{}{"type": "boolean"},
+					"results": arrayOf("BatchTaskResult"),
+				},
+			})),
+		}, stringParam("name")),
+		"/api/folders": map[string]interface{}{
+			"get": op("Folder tree with task counts", nil),
+		},
+		"/api/runs/export": map[string]interface{}{
+			"get": op("Stream runs since ?since, optionally for one ?task_id; one Run per line", map[string]interface{}{
+				"content": map[string]interface{}{"application/x-ndjson": map[string]interface{}{"schema": ref("Run")}},
+			}),
+		},
+		"/api/triggers/{token}": withParams(map[string]interface{}{
+			"post": trigger,
+		}, stringParam("token")),
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "Opencron API", "version": "1.0.0"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []map[string]interface{}{{"apiKey": []string{}}},
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// jsonSchema describes how encoding/json renders values of type t.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		addStructProperties(t, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
+
+// addStructProperties adds t's JSON fields to properties, flattening embedded
+// structs as encoding/json does.
+func addStructProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(ft, properties)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = jsonSchema(f.Type)
+	}
+}
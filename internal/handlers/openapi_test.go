@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	api := newTestAPI(t)
+	t.Setenv("API_KEY", "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 without an API key, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	var doc struct {
+		OpenAPI    string                     `json:"openapi"`
+		Paths      map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type   string `json:"type"`
+					Format string `json:"format"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/api/tasks/{id}/runs"]; !ok {
+		t.Fatalf("expected the runs path, got %v", doc.Paths)
+	}
+
+	task := doc.Components.Schemas["Task"].Properties
+	if task["command_file"].Type != "string" || task["created_at"].Format != "date-time" || task["steps"].Type != "array" {
+		t.Fatalf("expected the Task schema to follow models.Task, got %+v", task)
+	}
+	if _, ok := doc.Components.Schemas["RunResult"].Properties["Err"]; ok {
+		t.Fatalf("expected json:\"-\" fields to be left out")
+	}
+}
+
+// TestOpenAPIPathsRouted sends a request for every documented operation and
+// checks that ServeHTTP routes it rather than falling through to the static
+// files or answering with an empty 200, and that every route ServeHTTP
+// serves under /api/ is documented.
+func TestOpenAPIPathsRouted(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	body, _ := json.Marshal(openAPIDocument())
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			// Each request gets its own API so deletes and toggles don't
+			// affect the others.
+			api := newTestAPI(t)
+			api.DevMode = true
+			task := models.Task{Name: "routed", Schedule: "@daily", Command: runnableCommand()}
+			if err := api.Store.CreateTask(&task); err != nil {
+				t.Fatalf("failed to create task: %v", err)
+			}
+			if err := api.Store.CreateRun(&models.Run{TaskID: task.ID, Status: models.RunStatusSuccess, StartedAt: time.Now()}); err != nil {
+				t.Fatalf("failed to create run: %v", err)
+			}
+			target := strings.NewReplacer("{id}", strconv.Itoa(task.ID), "{run_id}", "1", "{name}", "none", "{token}", "none").Replace(path)
+			if strings.HasSuffix(target, "/run") {
+				target += "?dry=true"
+			}
+			req := httptest.NewRequest(strings.ToUpper(method), target, strings.NewReader(`{}`))
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code == http.StatusMethodNotAllowed || rec.Body.String() == "404 page not found\n" || (rec.Code == http.StatusOK && rec.Body.Len() == 0) {
+				t.Errorf("%s %s is documented but not routed: %d %q", method, path, rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	for _, route := range []string{
+		"/api/tasks", "/api/tasks/{id}", "/api/tasks/upcoming", "/api/tasks/import",
+		"/api/tasks/bulk-enable", "/api/tasks/bulk-disable", "/api/tasks/duplicate-check",
+		"/api/tasks/preview", "/api/tasks/{id}/run", "/api/tasks/{id}/runs",
+		"/api/tasks/{id}/runs/{run_id}/logs", "/api/tasks/{id}/schedule",
+		"/api/tasks/{id}/duplicate-check", "/api/tasks/{id}/history", "/api/tasks/{id}/logs",
+		"/api/tasks/{id}/logs/size", "/api/tasks/{id}/logs/search", "/api/tasks/{id}/logs/files",
+		"/api/tasks/{id}/archive", "/api/tasks/{id}/trigger-token", "/api/tasks/{id}/snooze",
+		"/api/tasks/{id}/validate-command", "/api/tasks/{id}/lock", "/api/tasks/{id}/unlock",
+		"/api/tasks/{id}/reset", "/api/maintenance/on", "/api/maintenance/off", "/api/config",
+		"/api/scheduler/status", "/api/scheduler/tick", "/api/queue", "/api/batches/{name}/run",
+		"/api/notifications/test", "/api/folders", "/api/runs/export", "/api/triggers/{token}",
+	} {
+		if _, ok := doc.Paths[route]; !ok {
+			t.Errorf("%s is served but not documented", route)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TaskChange is one recorded edit of a task. Changes maps each JSON field
+// that changed to its old and new values.
+type TaskChange struct {
+	ID        int                    `json:"id"`
+	TaskID    int                    `json:"task_id"`
+	ChangedAt time.Time              `json:"changed_at"`
+	ChangedBy string                 `json:"changed_by"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
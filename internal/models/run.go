@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	RunStatusRunning = "running"
+	RunStatusSuccess = "success"
+	RunStatusFailed  = "failed"
+	// RunStatusSkipped records a scheduled fire whose RunCondition was not
+	// met; nothing was executed.
+	RunStatusSkipped = "skipped"
+)
+
+type Run struct {
+	ID         int    `json:"id"`
+	TaskID     int    `json:"task_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	FailedStep int    `json:"failed_step,omitempty"`
+	LogFile    string `json:"log_file"`
+	// LogOffset and LogLength locate this run's output within LogFile.
+	LogOffset  int64     `json:"log_offset"`
+	LogLength  int64     `json:"log_length"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
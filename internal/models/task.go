@@ -1,14 +1,107 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// NotifyOn values select which run outcomes fire a task's notify_url.
+const (
+	NotifyOnFailure = "failure"
+	NotifyOnSuccess = "success"
+	NotifyOnAlways  = "always"
+)
+
+// MissedRunPolicy values decide what happens to scheduled runs missed while
+// the server was down. An empty policy behaves like MissedRunSkip.
+const (
+	MissedRunSkip    = "skip"
+	MissedRunRunOnce = "run_once"
+)
+
+// RunCondition values gate a scheduled run on the outcome of the task's
+// previous run. An empty condition behaves like RunConditionAlways.
+const (
+	RunConditionAlways        = "always"
+	RunConditionOnPrevSuccess = "on_prev_success"
+	RunConditionOnPrevFailure = "on_prev_failure"
+)
+
+// OutputFormat values tell clients how to render a task's log output. An
+// empty format behaves like OutputFormatText.
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+	OutputFormatANSI = "ansi"
+)
+
+// LogMarkers values select how the lines marking where runs start and finish
+// are written into log files. Empty uses the server's LOG_MARKERS, which
+// defaults to LogMarkersText.
+const (
+	// LogMarkersText writes "--- Run #1 of task x started at ... ---" lines.
+	LogMarkersText = "text"
+	// LogMarkersJSON writes one JSON object per marker, starting with
+	// {"opencron":.
+	LogMarkersJSON = "json"
+)
 
 type Task struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Schedule  string    `json:"schedule"`
-	Command   string    `json:"command"`
-	Enabled   bool      `json:"enabled"`
-	OneShot   bool      `json:"one_shot"`
-	CreatedAt time.Time `json:"created_at"`
-	LastRun   time.Time `json:"last_run"`
+	ID                       int             `json:"id"`
+	Name                     string          `json:"name"`
+	Schedule                 string          `json:"schedule"`
+	Command                  string          `json:"command"`
+	Enabled                  bool            `json:"enabled"`
+	OneShot                  bool            `json:"one_shot"`
+	CreatedAt                time.Time       `json:"created_at"`
+	LastRun                  time.Time       `json:"last_run"`
+	PausedUntil              time.Time       `json:"paused_until"`
+	TriggerToken             string          `json:"trigger_token,omitempty"`
+	ExtraPath                []string        `json:"extra_path"`
+	LastScheduleOK           bool            `json:"last_schedule_ok"`
+	ScheduleError            string          `json:"schedule_error,omitempty"`
+	NotifyURL                string          `json:"notify_url"`
+	AlertAfterFailures       int             `json:"alert_after_failures"`
+	FreshWorkdir             bool            `json:"fresh_workdir"`
+	KeepWorkdirOnFailure     bool            `json:"keep_workdir_on_failure"`
+	NotifyOn                 string          `json:"notify_on"`
+	Folder                   string          `json:"folder"`
+	Steps                    []string        `json:"steps"`
+	ContinueOnError          bool            `json:"continue_on_error"`
+	EnvFile                  string          `json:"env_file"`
+	SortOrder                int             `json:"sort_order"`
+	MaxInstances             int             `json:"max_instances"`
+	LastError                string          `json:"last_error,omitempty"`
+	Version                  int             `json:"version"`
+	ExpandEnv                bool            `json:"expand_env"`
+	MissedRunPolicy          string          `json:"missed_run_policy"`
+	CreatedBy                string          `json:"created_by"`
+	SuccessExitCodes         []int           `json:"success_exit_codes"`
+	AlertCooldownMinutes     int             `json:"alert_cooldown_minutes"`
+	OutputCommand            string          `json:"output_command"`
+	OutputCommandOnly        bool            `json:"output_command_only"`
+	Environments             []string        `json:"environments"`
+	SkipWindows              [][2]string     `json:"skip_windows"`
+	TimestampLines           bool            `json:"timestamp_lines"`
+	StartAfter               time.Time       `json:"start_after"`
+	RunCondition             string          `json:"run_condition"`
+	Nice                     int             `json:"nice"`
+	Batch                    string          `json:"batch"`
+	CommandFile              string          `json:"command_file"`
+	AutoDisableAfterFailures int             `json:"auto_disable_after_failures"`
+	Metadata                 json.RawMessage `json:"metadata"`
+	AutoDisabled             bool            `json:"auto_disabled"`
+	ModifiedBy               string          `json:"modified_by"`
+	TimeoutSeconds           int             `json:"timeout_seconds"`
+	KillGraceSeconds         int             `json:"kill_grace_seconds"`
+	CommandSHA256            string          `json:"command_sha256"`
+	OutputFormat             string          `json:"output_format"`
+	Locked                   bool            `json:"locked"`
+	LogMarkers               string          `json:"log_markers"`
+	Sandbox                  bool            `json:"sandbox"`
+	SandboxImage             string          `json:"sandbox_image"`
+	Muted                    bool            `json:"muted"`
+	Schedules                []string        `json:"schedules"`
+	CommandWindows           string          `json:"command_windows"`
+	CommandUnix              string          `json:"command_unix"`
 }
@@ -1,16 +1,71 @@
 package store
 
 import (
+	"bytes"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/opencron/opencron/internal/models"
 	_ "modernc.org/sqlite"
 )
 
+// ErrVersionMismatch is returned by UpdateTaskIfVersion when the task was
+// changed since the caller read it.
+var ErrVersionMismatch = errors.New("task version mismatch")
+
+// ErrTaskLocked is returned by DeleteTask when the task is locked and force
+// is false.
+var ErrTaskLocked = errors.New("task is locked")
+
 type Store struct {
 	db *sql.DB
+
+	// The task list is cached between writes, since the engine re-reads it
+	// on every Reload. cacheGen is bumped by each write so a read that
+	// raced one does not repopulate the cache with stale rows.
+	cacheMu     sync.Mutex
+	cacheGen    uint64
+	cacheValid  bool
+	cachedTasks []models.Task
+	// taskQueries counts task list reads that reached the database.
+	taskQueries atomic.Int64
+}
+
+// invalidateTasks drops the cached task list; every write to the tasks table
+// must call it or, for run bookkeeping columns, updateCachedTask.
+func (s *Store) invalidateTasks() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.cacheGen++
+	s.cacheValid = false
+	s.cachedTasks = nil
+}
+
+// updateCachedTask applies a write of run bookkeeping columns to the cached
+// task in place, so that runs don't drop the whole task list. It must be
+// called after the write succeeded.
+func (s *Store) updateCachedTask(id int, update func(*models.Task)) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.cacheGen++
+	if !s.cacheValid {
+		return
+	}
+	for i := range s.cachedTasks {
+		if s.cachedTasks[i].ID == id {
+			update(&s.cachedTasks[i])
+			return
+		}
+	}
 }
 
 func (s *Store) Close() error {
@@ -40,8 +95,73 @@ func hasColumn(db *sql.DB, tableName, columnName string) (bool, error) {
 	return false, rows.Err()
 }
 
+// columnMigrations lists columns added after a table's initial schema.
+// Databases missing any of them are migrated on startup.
+var columnMigrations = []struct {
+	table      string
+	name       string
+	definition string
+}{
+	{"tasks", "one_shot", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "paused_until", "DATETIME"},
+	{"tasks", "trigger_token", "TEXT DEFAULT ''"},
+	{"tasks", "extra_path", "TEXT DEFAULT '[]'"},
+	{"tasks", "last_schedule_ok", "BOOLEAN DEFAULT TRUE"},
+	{"tasks", "schedule_error", "TEXT DEFAULT ''"},
+	{"tasks", "notify_url", "TEXT DEFAULT ''"},
+	{"tasks", "alert_after_failures", "INTEGER DEFAULT 0"},
+	{"tasks", "fresh_workdir", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "keep_workdir_on_failure", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "notify_on", "TEXT DEFAULT 'failure'"},
+	{"tasks", "folder", "TEXT DEFAULT ''"},
+	{"tasks", "steps", "TEXT DEFAULT '[]'"},
+	{"tasks", "continue_on_error", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "env_file", "TEXT DEFAULT ''"},
+	{"tasks", "sort_order", "INTEGER DEFAULT 0"},
+	{"tasks", "max_instances", "INTEGER DEFAULT 0"},
+	{"tasks", "last_error", "TEXT DEFAULT ''"},
+	{"tasks", "version", "INTEGER DEFAULT 1"},
+	{"tasks", "expand_env", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "missed_run_policy", "TEXT DEFAULT ''"},
+	{"tasks", "created_by", "TEXT DEFAULT ''"},
+	{"tasks", "success_exit_codes", "TEXT DEFAULT ''"},
+	{"tasks", "alert_cooldown_minutes", "INTEGER DEFAULT 0"},
+	{"tasks", "output_command", "TEXT DEFAULT ''"},
+	{"tasks", "output_command_only", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "environments", "TEXT DEFAULT '[]'"},
+	{"tasks", "skip_windows", "TEXT DEFAULT '[]'"},
+	{"tasks", "timestamp_lines", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "start_after", "DATETIME"},
+	{"tasks", "run_condition", "TEXT DEFAULT ''"},
+	{"tasks", "nice", "INTEGER DEFAULT 0"},
+	{"tasks", "batch", "TEXT DEFAULT ''"},
+	{"tasks", "command_file", "TEXT DEFAULT ''"},
+	{"tasks", "auto_disable_after_failures", "INTEGER DEFAULT 0"},
+	{"tasks", "metadata", "TEXT DEFAULT ''"},
+	{"tasks", "auto_disabled", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "failures_reset_run_id", "INTEGER DEFAULT 0"},
+	{"tasks", "modified_by", "TEXT DEFAULT ''"},
+	{"tasks", "timeout_seconds", "INTEGER DEFAULT 0"},
+	{"tasks", "kill_grace_seconds", "INTEGER DEFAULT 0"},
+	{"tasks", "command_sha256", "TEXT DEFAULT ''"},
+	{"tasks", "output_format", "TEXT DEFAULT ''"},
+	{"tasks", "locked", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "log_markers", "TEXT DEFAULT ''"},
+	{"tasks", "sandbox", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "sandbox_image", "TEXT DEFAULT ''"},
+	{"tasks", "muted", "BOOLEAN DEFAULT FALSE"},
+	{"tasks", "schedules", "TEXT DEFAULT '[]'"},
+	{"tasks", "command_windows", "TEXT DEFAULT ''"},
+	{"tasks", "command_unix", "TEXT DEFAULT ''"},
+	{"runs", "failed_step", "INTEGER DEFAULT 0"},
+	{"runs", "log_offset", "INTEGER DEFAULT 0"},
+	{"runs", "log_length", "INTEGER DEFAULT 0"},
+}
+
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// Runs finish on their own goroutines, so let writers wait on each other
+	// instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
@@ -63,37 +183,411 @@ func New(dbPath string) (*Store, error) {
 		return nil, err
 	}
 
-	// Migrate older databases that don't yet have one_shot.
-	hasOneShot, err := hasColumn(db, "tasks", "one_shot")
-	if err != nil {
+	runsQuery := `
+	CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER,
+		status TEXT,
+		error TEXT DEFAULT '',
+		log_file TEXT,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_runs_task_id ON runs(task_id);`
+
+	if _, err = db.Exec(runsQuery); err != nil {
+		return nil, err
+	}
+
+	settingsQuery := `
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);`
+
+	if _, err = db.Exec(settingsQuery); err != nil {
+		return nil, err
+	}
+
+	idempotencyQuery := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		task_id INTEGER,
+		created_at DATETIME
+	);`
+
+	if _, err = db.Exec(idempotencyQuery); err != nil {
 		return nil, err
 	}
-	if !hasOneShot {
-		if _, err = db.Exec(`ALTER TABLE tasks ADD COLUMN one_shot BOOLEAN DEFAULT FALSE`); err != nil {
+
+	changesQuery := `
+	CREATE TABLE IF NOT EXISTS task_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER,
+		changed_at DATETIME,
+		changed_by TEXT,
+		changes TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_task_changes_task_id ON task_changes(task_id);`
+
+	if _, err = db.Exec(changesQuery); err != nil {
+		return nil, err
+	}
+
+	for _, col := range columnMigrations {
+		exists, err := hasColumn(db, col.table, col.name)
+		if err != nil {
 			return nil, err
 		}
+		if !exists {
+			if _, err = db.Exec(`ALTER TABLE ` + col.table + ` ADD COLUMN ` + col.name + ` ` + col.definition); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return &Store{db: db}, nil
 }
 
+const taskColumns = `id, name, schedule, command, enabled, one_shot, created_at, last_run, paused_until, trigger_token, extra_path, last_schedule_ok, schedule_error, notify_url, alert_after_failures, fresh_workdir, keep_workdir_on_failure, notify_on, folder, steps, continue_on_error, env_file, sort_order, max_instances, last_error, version, expand_env, missed_run_policy, created_by, success_exit_codes, alert_cooldown_minutes, output_command, output_command_only, environments, skip_windows, timestamp_lines, start_after, run_condition, nice, batch, command_file, auto_disable_after_failures, metadata, auto_disabled, modified_by, timeout_seconds, kill_grace_seconds, command_sha256, output_format, locked, log_markers, sandbox, sandbox_image, muted, schedules, command_windows, command_unix`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// encodeJSON serializes list-valued task fields into a TEXT column.
+func encodeJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeJSON(data string, v interface{}) error {
+	if data == "" || data == "null" {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func scanTask(row scanner) (models.Task, error) {
+	var t models.Task
+	var lastRun, pausedUntil, startAfter sql.NullTime
+	var extraPath string
+	var schedules string
+	var metadata string
+	var skipWindows string
+	var environments string
+	var successExitCodes string
+	var steps string
+	if err := row.Scan(&t.ID, &t.Name, &t.Schedule, &t.Command, &t.Enabled, &t.OneShot, &t.CreatedAt, &lastRun, &pausedUntil, &t.TriggerToken, &extraPath, &t.LastScheduleOK, &t.ScheduleError, &t.NotifyURL, &t.AlertAfterFailures, &t.FreshWorkdir, &t.KeepWorkdirOnFailure, &t.NotifyOn, &t.Folder, &steps, &t.ContinueOnError, &t.EnvFile, &t.SortOrder, &t.MaxInstances, &t.LastError, &t.Version, &t.ExpandEnv, &t.MissedRunPolicy, &t.CreatedBy, &successExitCodes, &t.AlertCooldownMinutes, &t.OutputCommand, &t.OutputCommandOnly, &environments, &skipWindows, &t.TimestampLines, &startAfter, &t.RunCondition, &t.Nice, &t.Batch, &t.CommandFile, &t.AutoDisableAfterFailures, &metadata, &t.AutoDisabled, &t.ModifiedBy, &t.TimeoutSeconds, &t.KillGraceSeconds, &t.CommandSHA256, &t.OutputFormat, &t.Locked, &t.LogMarkers, &t.Sandbox, &t.SandboxImage, &t.Muted, &schedules, &t.CommandWindows, &t.CommandUnix); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(extraPath, &t.ExtraPath); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(schedules, &t.Schedules); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(metadata, &t.Metadata); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(skipWindows, &t.SkipWindows); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(environments, &t.Environments); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(successExitCodes, &t.SuccessExitCodes); err != nil {
+		return t, err
+	}
+	if err := decodeJSON(steps, &t.Steps); err != nil {
+		return t, err
+	}
+	if lastRun.Valid {
+		t.LastRun = lastRun.Time
+	}
+	if pausedUntil.Valid {
+		t.PausedUntil = pausedUntil.Time
+	}
+	if startAfter.Valid {
+		t.StartAfter = startAfter.Time
+	}
+	return t, nil
+}
+
+// NewTriggerToken returns a random token used to trigger a task via webhook.
+func NewTriggerToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (s *Store) CreateTask(task *models.Task) error {
+	defer s.invalidateTasks()
+	return insertTask(s.db, task, 0)
+}
+
+// insertTask stores a new task. A positive id is used as the row id instead
+// of the next auto-increment value.
+func insertTask(db execer, task *models.Task, id int) error {
 	task.CreatedAt = time.Now()
-	query := `INSERT INTO tasks (name, schedule, command, enabled, one_shot, created_at, last_run) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	res, err := s.db.Exec(query, task.Name, task.Schedule, task.Command, task.Enabled, task.OneShot, task.CreatedAt, time.Time{})
+	task.ModifiedBy = task.CreatedBy
+	token, err := NewTriggerToken()
 	if err != nil {
 		return err
 	}
-	id, err := res.LastInsertId()
+	task.TriggerToken = token
+	// Matches the column defaults until the engine reports otherwise.
+	task.LastScheduleOK = true
+	task.Version = 1
+	query := `INSERT INTO tasks (id, name, schedule, command, enabled, one_shot, created_at, last_run, paused_until, trigger_token, extra_path, notify_url, alert_after_failures, fresh_workdir, keep_workdir_on_failure, notify_on, folder, steps, continue_on_error, env_file, sort_order, max_instances, expand_env, missed_run_policy, created_by, success_exit_codes, alert_cooldown_minutes, output_command, output_command_only, environments, skip_windows, timestamp_lines, start_after, run_condition, nice, batch, command_file, auto_disable_after_failures, metadata, modified_by, timeout_seconds, kill_grace_seconds, command_sha256, output_format, locked, log_markers, sandbox, sandbox_image, muted, schedules, command_windows, command_unix) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	// A NULL id makes SQLite pick the next one.
+	var explicitID interface{}
+	if id > 0 {
+		explicitID = id
+	}
+	res, err := db.Exec(query, explicitID, task.Name, task.Schedule, task.Command, task.Enabled, task.OneShot, task.CreatedAt, time.Time{}, task.PausedUntil, task.TriggerToken, encodeJSON(task.ExtraPath), task.NotifyURL, task.AlertAfterFailures, task.FreshWorkdir, task.KeepWorkdirOnFailure, task.NotifyOn, task.Folder, encodeJSON(task.Steps), task.ContinueOnError, task.EnvFile, task.SortOrder, task.MaxInstances, task.ExpandEnv, task.MissedRunPolicy, task.CreatedBy, encodeJSON(task.SuccessExitCodes), task.AlertCooldownMinutes, task.OutputCommand, task.OutputCommandOnly, encodeJSON(task.Environments), encodeJSON(task.SkipWindows), task.TimestampLines, task.StartAfter, task.RunCondition, task.Nice, task.Batch, task.CommandFile, task.AutoDisableAfterFailures, encodeJSON(task.Metadata), task.CreatedBy, task.TimeoutSeconds, task.KillGraceSeconds, task.CommandSHA256, task.OutputFormat, task.Locked, task.LogMarkers, task.Sandbox, task.SandboxImage, task.Muted, encodeJSON(task.Schedules), task.CommandWindows, task.CommandUnix)
 	if err != nil {
 		return err
 	}
-	task.ID = int(id)
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	task.ID = int(newID)
 	return nil
 }
 
+// GetSetting returns a server-wide setting, or "" if it was never set.
+func (s *Store) GetSetting(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key=?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetSetting stores a server-wide setting.
+func (s *Store) SetSetting(key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value`, key, value)
+	return err
+}
+
+// IdempotentTaskID returns the id of the task created with an idempotency key
+// since the given time, or sql.ErrNoRows if there is none.
+func (s *Store) IdempotentTaskID(key string, since time.Time) (int, error) {
+	var id int
+	err := s.db.QueryRow(`SELECT k.task_id FROM idempotency_keys k JOIN tasks t ON t.id = k.task_id WHERE k.key=? AND k.created_at >= ?`, key, since).Scan(&id)
+	return id, err
+}
+
+// CreateTaskIdempotent creates a task unless one was already created with the
+// same idempotency key since the given time, in which case it returns that
+// task's id and leaves task untouched. Keys older than since are pruned.
+func (s *Store) CreateTaskIdempotent(task *models.Task, key string, since time.Time) (existingID int, err error) {
+	defer s.invalidateTasks()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, since); err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow(`SELECT k.task_id FROM idempotency_keys k JOIN tasks t ON t.id = k.task_id WHERE k.key=?`, key).Scan(&existingID)
+	if err == nil {
+		return existingID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	if err := insertTask(tx, task, 0); err != nil {
+		return 0, err
+	}
+	// Replaces a key left behind by a task that has since been deleted.
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO idempotency_keys (key, task_id, created_at) VALUES (?, ?, ?)`, key, task.ID, time.Now()); err != nil {
+		return 0, err
+	}
+	return 0, tx.Commit()
+}
+
+// CountTasks returns the number of stored tasks.
+func (s *Store) CountTasks() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&n)
+	return n, err
+}
+
+// taskOrders maps the sort keys accepted by GetTasksSorted to ORDER BY
+// clauses. The id tiebreak keeps output stable across edits.
+var taskOrders = map[string]string{
+	"":        "sort_order, id",
+	"name":    "name COLLATE NOCASE, id",
+	"created": "created_at, id",
+}
+
+// IsTaskOrder reports whether GetTasksSorted accepts the sort key.
+func IsTaskOrder(sortBy string) bool {
+	_, ok := taskOrders[sortBy]
+	return ok
+}
+
+// ImportTaskError describes why one entry of an import was rejected.
+type ImportTaskError struct {
+	// Index is the entry's position in the imported list.
+	Index  int      `json:"index"`
+	Name   string   `json:"name"`
+	Errors []string `json:"errors"`
+}
+
+// ImportError is returned by ImportTasks when any entry is rejected. Nothing
+// is imported in that case.
+type ImportError struct {
+	Tasks []ImportTaskError
+}
+
+func (e *ImportError) Error() string {
+	msgs := make([]string, 0, len(e.Tasks))
+	for _, t := range e.Tasks {
+		msgs = append(msgs, fmt.Sprintf("task %d (%q): %s", t.Index, t.Name, strings.Join(t.Errors, "; ")))
+	}
+	return "import rejected: " + strings.Join(msgs, "; ")
+}
+
+// ImportTasks inserts tasks in a single transaction. Every task is first
+// checked with validate, if given, which returns the task's problems, and,
+// with preserveIDs, for an id already used by an earlier entry. If any task
+// has problems, an *ImportError listing all of them is returned and nothing
+// is inserted. A task that then fails to insert returns a plain error naming
+// it, since that is a storage failure rather than a problem with the input.
+// With preserveIDs, each task keeps its original id when that id is free;
+// otherwise, and for tasks whose id is taken, a new id is assigned. The
+// returned map records every task whose id changed, old to new.
+func (s *Store) ImportTasks(tasks []models.Task, preserveIDs bool, validate func(models.Task) []string) (map[int]int, error) {
+	rejected := &ImportError{}
+	seen := map[int]int{}
+	for i, t := range tasks {
+		var errs []string
+		if validate != nil {
+			errs = validate(t)
+		}
+		// The returned map could only record one of them. Without
+		// preserveIDs the ids are ignored, so merged exports may repeat
+		// them.
+		if first, ok := seen[t.ID]; ok && preserveIDs {
+			errs = append(errs, fmt.Sprintf("duplicate id %d, also used by task %d", t.ID, first))
+		} else if t.ID > 0 {
+			seen[t.ID] = i
+		}
+		if len(errs) > 0 {
+			rejected.Tasks = append(rejected.Tasks, ImportTaskError{Index: i, Name: t.Name, Errors: errs})
+		}
+	}
+	if len(rejected.Tasks) > 0 {
+		return nil, rejected
+	}
+	insertFailed := func(i int, err error) error {
+		return fmt.Errorf("failed to import task %d (%q): %w", i, tasks[i].Name, err)
+	}
+
+	defer s.invalidateTasks()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	remapped := map[int]int{}
+	// Claim free explicit ids first so auto-assigned ids can't take them.
+	pending := make([]int, 0, len(tasks))
+	for i := range tasks {
+		oldID := tasks[i].ID
+		if preserveIDs && oldID > 0 {
+			var taken int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id=?`, oldID).Scan(&taken); err != nil {
+				return nil, err
+			}
+			if taken == 0 {
+				if err := insertTask(tx, &tasks[i], oldID); err != nil {
+					return nil, insertFailed(i, err)
+				}
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+	for _, i := range pending {
+		oldID := tasks[i].ID
+		if err := insertTask(tx, &tasks[i], 0); err != nil {
+			return nil, insertFailed(i, err)
+		}
+		if oldID > 0 {
+			remapped[oldID] = tasks[i].ID
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return remapped, nil
+}
+
+// GetTasks returns every task in the default order, from the cache when no
+// task has been written since the last read. The returned slice is the
+// caller's own, but slice fields of the tasks are shared with the cache and
+// must not be modified.
 func (s *Store) GetTasks() ([]models.Task, error) {
-	rows, err := s.db.Query(`SELECT id, name, schedule, command, enabled, one_shot, created_at, last_run FROM tasks`)
+	s.cacheMu.Lock()
+	if s.cacheValid {
+		tasks := slices.Clone(s.cachedTasks)
+		s.cacheMu.Unlock()
+		return tasks, nil
+	}
+	gen := s.cacheGen
+	s.cacheMu.Unlock()
+
+	tasks, err := s.queryTasks(taskOrders[""])
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if gen == s.cacheGen {
+		s.cachedTasks = tasks
+		s.cacheValid = true
+	}
+	return slices.Clone(tasks), nil
+}
+
+// GetTasksSorted returns every task ordered by sortBy, one of "", "name" or
+// "created".
+func (s *Store) GetTasksSorted(sortBy string) ([]models.Task, error) {
+	order, ok := taskOrders[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown task order %q", sortBy)
+	}
+	if sortBy == "" {
+		return s.GetTasks()
+	}
+	return s.queryTasks(order)
+}
+
+func (s *Store) queryTasks(order string) ([]models.Task, error) {
+	s.taskQueries.Add(1)
+	rows, err := s.db.Query(`SELECT ` + taskColumns + ` FROM tasks ORDER BY ` + order)
 	if err != nil {
 		return nil, err
 	}
@@ -101,48 +595,574 @@ func (s *Store) GetTasks() ([]models.Task, error) {
 
 	var tasks []models.Task
 	for rows.Next() {
-		var t models.Task
-		var lastRun sql.NullTime
-		if err := rows.Scan(&t.ID, &t.Name, &t.Schedule, &t.Command, &t.Enabled, &t.OneShot, &t.CreatedAt, &lastRun); err != nil {
+		t, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
-		if lastRun.Valid {
-			t.LastRun = lastRun.Time
-		}
 		tasks = append(tasks, t)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return tasks, nil
 }
 
 func (s *Store) GetTaskByID(id int) (*models.Task, error) {
-	row := s.db.QueryRow(`SELECT id, name, schedule, command, enabled, one_shot, created_at, last_run FROM tasks WHERE id=?`, id)
+	row := s.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id=?`, id)
 
-	var t models.Task
-	var lastRun sql.NullTime
-	if err := row.Scan(&t.ID, &t.Name, &t.Schedule, &t.Command, &t.Enabled, &t.OneShot, &t.CreatedAt, &lastRun); err != nil {
+	t, err := scanTask(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
 		return nil, err
 	}
-	if lastRun.Valid {
-		t.LastRun = lastRun.Time
+	return &t, nil
+}
+
+// FindSimilar returns the tasks, other than excludeID, that look like a
+// duplicate of one with the given fields: the same name ignoring case and
+// surrounding spaces, or the same command and schedule. Empty fields match
+// nothing.
+func (s *Store) FindSimilar(name, command, schedule string, excludeID int) ([]models.Task, error) {
+	name, command, schedule = strings.TrimSpace(name), strings.TrimSpace(command), strings.TrimSpace(schedule)
+	rows, err := s.db.Query(`SELECT `+taskColumns+` FROM tasks WHERE id<>? AND ((?<>'' AND LOWER(TRIM(name))=LOWER(?)) OR (?<>'' AND ?<>'' AND TRIM(command)=? AND TRIM(schedule)=?)) ORDER BY id`,
+		excludeID, name, name, command, schedule, command, schedule)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *Store) GetTaskByTriggerToken(token string) (*models.Task, error) {
+	if token == "" {
+		return nil, sql.ErrNoRows
+	}
+	row := s.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE trigger_token=?`, token)
+
+	t, err := scanTask(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
 	}
 	return &t, nil
 }
 
+func (s *Store) SetTriggerToken(id int, token string) error {
+	defer s.invalidateTasks()
+	_, err := s.db.Exec(`UPDATE tasks SET trigger_token=? WHERE id=?`, token, id)
+	return err
+}
+
 func (s *Store) UpdateTask(task *models.Task) error {
-	query := `UPDATE tasks SET name=?, schedule=?, command=?, enabled=?, one_shot=? WHERE id=?`
-	_, err := s.db.Exec(query, task.Name, task.Schedule, task.Command, task.Enabled, task.OneShot, task.ID)
+	return s.updateTask(task, 0)
+}
+
+// UpdateTaskIfVersion updates the task only if its stored version still
+// equals version, returning ErrVersionMismatch otherwise.
+func (s *Store) UpdateTaskIfVersion(task *models.Task, version int) error {
+	return s.updateTask(task, version)
+}
+
+// updateTask saves task, bumping its version, and in the same transaction
+// records the fields that changed in task_changes, attributed to
+// task.ModifiedBy. A non-zero version makes the update conditional on the
+// stored version.
+func (s *Store) updateTask(task *models.Task, version int) error {
+	defer s.invalidateTasks()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := scanTask(tx.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id=?`, task.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		if version != 0 {
+			return ErrVersionMismatch
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE tasks SET name=?, schedule=?, command=?, enabled=?, one_shot=?, paused_until=?, extra_path=?, notify_url=?, alert_after_failures=?, fresh_workdir=?, keep_workdir_on_failure=?, notify_on=?, folder=?, steps=?, continue_on_error=?, env_file=?, sort_order=?, max_instances=?, expand_env=?, missed_run_policy=?, success_exit_codes=?, alert_cooldown_minutes=?, output_command=?, output_command_only=?, environments=?, skip_windows=?, timestamp_lines=?, start_after=?, run_condition=?, nice=?, batch=?, command_file=?, auto_disable_after_failures=?, metadata=?, auto_disabled=auto_disabled AND NOT ?, modified_by=?, timeout_seconds=?, kill_grace_seconds=?, command_sha256=?, output_format=?, log_markers=?, sandbox=?, sandbox_image=?, muted=?, schedules=?, command_windows=?, command_unix=?, version=version+1 WHERE id=? AND (?=0 OR version=?) RETURNING version`
+	err = tx.QueryRow(query, task.Name, task.Schedule, task.Command, task.Enabled, task.OneShot, task.PausedUntil, encodeJSON(task.ExtraPath), task.NotifyURL, task.AlertAfterFailures, task.FreshWorkdir, task.KeepWorkdirOnFailure, task.NotifyOn, task.Folder, encodeJSON(task.Steps), task.ContinueOnError, task.EnvFile, task.SortOrder, task.MaxInstances, task.ExpandEnv, task.MissedRunPolicy, encodeJSON(task.SuccessExitCodes), task.AlertCooldownMinutes, task.OutputCommand, task.OutputCommandOnly, encodeJSON(task.Environments), encodeJSON(task.SkipWindows), task.TimestampLines, task.StartAfter, task.RunCondition, task.Nice, task.Batch, task.CommandFile, task.AutoDisableAfterFailures, encodeJSON(task.Metadata), task.Enabled, task.ModifiedBy, task.TimeoutSeconds, task.KillGraceSeconds, task.CommandSHA256, task.OutputFormat, task.LogMarkers, task.Sandbox, task.SandboxImage, task.Muted, encodeJSON(task.Schedules), task.CommandWindows, task.CommandUnix, task.ID, version, version).Scan(&task.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVersionMismatch
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := recordChanges(tx, old, task.ModifiedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordChanges records in task_changes the fields in which the stored task
+// now differs from old, its state before the write, attributed to changedBy.
+func recordChanges(tx *sql.Tx, old models.Task, changedBy string) error {
+	updated, err := scanTask(tx.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id=?`, old.ID))
+	if err != nil {
+		return err
+	}
+	changes, err := taskChanges(old, updated)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO task_changes (task_id, changed_at, changed_by, changes) VALUES (?, ?, ?, ?)`,
+		old.ID, time.Now(), changedBy, encodeJSON(changes))
+	return err
+}
+
+// updateTaskRow runs query, an UPDATE of the task with the given id, and
+// records the changes it made, attributed to changedBy. It reports whether
+// the UPDATE matched the task, and returns sql.ErrNoRows if there is no such
+// task.
+func (s *Store) updateTaskRow(id int, changedBy, query string, args ...interface{}) (bool, error) {
+	defer s.invalidateTasks()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	old, err := scanTask(tx.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id=?`, id))
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if err := recordChanges(tx, old, changedBy); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// taskChanges compares two versions of a task field by field, as they
+// appear in JSON. Bookkeeping fields are left out.
+func taskChanges(old, updated models.Task) (map[string]models.FieldChange, error) {
+	var before, after map[string]json.RawMessage
+	for _, v := range []struct {
+		task models.Task
+		into *map[string]json.RawMessage
+	}{{old, &before}, {updated, &after}} {
+		data, err := json.Marshal(v.task)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, v.into); err != nil {
+			return nil, err
+		}
+	}
+	changes := map[string]models.FieldChange{}
+	for field, value := range after {
+		if field == "version" || field == "modified_by" {
+			continue
+		}
+		if !bytes.Equal(before[field], value) {
+			changes[field] = models.FieldChange{Old: before[field], New: value}
+		}
+	}
+	return changes, nil
+}
+
+// GetTaskChanges returns the task's recorded edits, newest first.
+func (s *Store) GetTaskChanges(taskID int) ([]models.TaskChange, error) {
+	rows, err := s.db.Query(`SELECT id, task_id, changed_at, changed_by, changes FROM task_changes WHERE task_id=? ORDER BY id DESC`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.TaskChange{}
+	for rows.Next() {
+		var c models.TaskChange
+		var changes string
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.ChangedAt, &c.ChangedBy, &changes); err != nil {
+			return nil, err
+		}
+		if err := decodeJSON(changes, &c.Changes); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
+
+// SetScheduleStatus records whether the engine managed to schedule a task,
+// so failures stay visible after a restart.
+func (s *Store) SetScheduleStatus(id int, ok bool, scheduleErr string) error {
+	if _, err := s.db.Exec(`UPDATE tasks SET last_schedule_ok=?, schedule_error=? WHERE id=?`, ok, scheduleErr, id); err != nil {
+		return err
+	}
+	s.updateCachedTask(id, func(t *models.Task) {
+		t.LastScheduleOK = ok
+		t.ScheduleError = scheduleErr
+	})
+	return nil
+}
+
+// TaskFilter selects tasks for bulk updates. Folder matches the folder and
+// its subfolders; IDs, if set, further limits the match to those tasks.
+type TaskFilter struct {
+	Folder string
+	IDs    []int
+}
+
+// SetEnabledByFilter enables or disables every task matching the filter in a
+// single transaction and returns the ids it changed, in ascending order. Each
+// change is recorded in task_changes, attributed to changedBy.
+func (s *Store) SetEnabledByFilter(filter TaskFilter, enabled bool, changedBy string) ([]int, error) {
+	defer s.invalidateTasks()
+	where := ` WHERE enabled<>?`
+	args := []interface{}{enabled}
+	if filter.Folder != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Folder)
+		where += ` AND (folder=? OR folder LIKE ? ESCAPE '\')`
+		args = append(args, filter.Folder, escaped+"/%")
+	}
+	if len(filter.IDs) > 0 {
+		where += ` AND id IN (?` + strings.Repeat(`, ?`, len(filter.IDs)-1) + `)`
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+taskColumns+` FROM tasks`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var matched []models.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		matched = append(matched, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(matched))
+	for _, old := range matched {
+		if _, err := tx.Exec(`UPDATE tasks SET enabled=?, auto_disabled=auto_disabled AND NOT ?, version=version+1 WHERE id=?`, enabled, enabled, old.ID); err != nil {
+			return nil, err
+		}
+		if err := recordChanges(tx, old, changedBy); err != nil {
+			return nil, err
+		}
+		ids = append(ids, old.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// AutoDisableTask disables an enabled task on the engine's behalf, marking
+// it auto_disabled, and records the change as made by "engine". It reports
+// whether the task was changed.
+func (s *Store) AutoDisableTask(id int) (bool, error) {
+	changed, err := s.updateTaskRow(id, "engine", `UPDATE tasks SET enabled=FALSE, auto_disabled=TRUE, version=version+1 WHERE id=? AND enabled`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return changed, err
+}
+
+// ResetTaskFailures clears the task's last error, restarts its
+// consecutive-failure count from its latest run, and re-enables it if the
+// engine had auto-disabled it. The change is recorded as made by changedBy.
+func (s *Store) ResetTaskFailures(id int, changedBy string) error {
+	_, err := s.updateTaskRow(id, changedBy, `UPDATE tasks SET last_error='', failures_reset_run_id=(SELECT COALESCE(MAX(id), 0) FROM runs WHERE task_id=?), enabled=enabled OR auto_disabled, auto_disabled=FALSE, version=version+1 WHERE id=?`, id, id)
 	return err
 }
 
+// SetTaskLocked sets whether the task is protected from deletion. The change
+// is recorded as made by changedBy.
+func (s *Store) SetTaskLocked(id int, locked bool, changedBy string) error {
+	_, err := s.updateTaskRow(id, changedBy, `UPDATE tasks SET locked=?, version=version+1 WHERE id=?`, locked, id)
+	return err
+}
+
+// SetLastError records why the task's latest run failed; an empty string
+// clears it after a success.
+func (s *Store) SetLastError(id int, lastError string) error {
+	if _, err := s.db.Exec(`UPDATE tasks SET last_error=? WHERE id=?`, lastError, id); err != nil {
+		return err
+	}
+	s.updateCachedTask(id, func(t *models.Task) { t.LastError = lastError })
+	return nil
+}
+
 func (s *Store) UpdateLastRun(id int, t time.Time) error {
-	_, err := s.db.Exec(`UPDATE tasks SET last_run=? WHERE id=?`, t, id)
+	if _, err := s.db.Exec(`UPDATE tasks SET last_run=? WHERE id=?`, t, id); err != nil {
+		return err
+	}
+	s.updateCachedTask(id, func(task *models.Task) { task.LastRun = t })
+	return nil
+}
+
+// DeleteTask deletes the task along with its change history. A locked task
+// is only deleted with force; otherwise ErrTaskLocked is returned. The lock
+// is checked by the DELETE itself, so a task locked concurrently is never
+// deleted. Deleting a task that doesn't exist is not an error.
+func (s *Store) DeleteTask(id int, force bool) error {
+	defer s.invalidateTasks()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM tasks WHERE id=? AND (? OR NOT locked)`, id, force)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id=?`, id).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrTaskLocked
+		}
+		return nil
+	}
+	if _, err := tx.Exec(`DELETE FROM task_changes WHERE task_id=?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) CreateRun(run *models.Run) error {
+	query := `INSERT INTO runs (task_id, status, error, log_file, started_at, finished_at) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := s.db.Exec(query, run.TaskID, run.Status, run.Error, run.LogFile, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	run.ID = int(id)
+	return nil
+}
+
+// SetRunLogOffset records where a running run's output starts in its log
+// file, so its logs can be read before it finishes.
+func (s *Store) SetRunLogOffset(runID int, offset int64) error {
+	_, err := s.db.Exec(`UPDATE runs SET log_offset=? WHERE id=?`, offset, runID)
 	return err
 }
 
-func (s *Store) DeleteTask(id int) error {
-	_, err := s.db.Exec(`DELETE FROM tasks WHERE id=?`, id)
+func (s *Store) FinishRun(run *models.Run) error {
+	_, err := s.db.Exec(`UPDATE runs SET status=?, error=?, finished_at=?, failed_step=?, log_offset=?, log_length=? WHERE id=?`, run.Status, run.Error, run.FinishedAt, run.FailedStep, run.LogOffset, run.LogLength, run.ID)
 	return err
 }
+
+const runColumns = `id, task_id, status, error, log_file, started_at, finished_at, failed_step, log_offset, log_length`
+
+func scanRun(row scanner) (models.Run, error) {
+	var r models.Run
+	var finishedAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.TaskID, &r.Status, &r.Error, &r.LogFile, &r.StartedAt, &finishedAt, &r.FailedStep, &r.LogOffset, &r.LogLength); err != nil {
+		return r, err
+	}
+	if finishedAt.Valid {
+		r.FinishedAt = finishedAt.Time
+	}
+	return r, nil
+}
+
+// TaskRunStats summarizes a task's run history for metrics.
+type TaskRunStats struct {
+	// LastSuccess is when the latest successful run finished; zero if none.
+	LastSuccess time.Time
+	// LastStatus is the status of the latest run that succeeded or failed;
+	// empty if none.
+	LastStatus string
+}
+
+// RunStats returns run statistics keyed by task id, for tasks that have
+// finished at least one run.
+func (s *Store) RunStats() (map[int]TaskRunStats, error) {
+	stats := map[int]TaskRunStats{}
+	rows, err := s.db.Query(`SELECT task_id, status FROM runs WHERE id IN (SELECT MAX(id) FROM runs WHERE status IN (?, ?) GROUP BY task_id)`, models.RunStatusSuccess, models.RunStatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var status string
+		if err := rows.Scan(&taskID, &status); err != nil {
+			return nil, err
+		}
+		stats[taskID] = TaskRunStats{LastStatus: status}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT task_id, finished_at FROM runs WHERE id IN (SELECT MAX(id) FROM runs WHERE status=? GROUP BY task_id)`, models.RunStatusSuccess)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&taskID, &finishedAt); err != nil {
+			return nil, err
+		}
+		st := stats[taskID]
+		st.LastSuccess = finishedAt.Time
+		stats[taskID] = st
+	}
+	return stats, rows.Err()
+}
+
+// GetRun returns one run of a task, or sql.ErrNoRows if the task has no run
+// with that id.
+func (s *Store) GetRun(taskID, runID int) (*models.Run, error) {
+	r, err := scanRun(s.db.QueryRow(`SELECT `+runColumns+` FROM runs WHERE id=? AND task_id=?`, runID, taskID))
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetRuns returns the run history of a task, most recent first.
+func (s *Store) GetRuns(taskID int) ([]models.Run, error) {
+	rows, err := s.db.Query(`SELECT `+runColumns+` FROM runs WHERE task_id=? ORDER BY id DESC`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.Run{}
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// utcOffsetSpan covers every UTC offset in use, from -12:00 to +14:00.
+const utcOffsetSpan = 26 * time.Hour
+
+// EachRun calls fn for every run in id order, streaming rows straight from
+// the database. A zero since or taskID disables that filter.
+func (s *Store) EachRun(since time.Time, taskID int, fn func(models.Run) error) error {
+	query := `SELECT ` + runColumns + ` FROM runs WHERE 1=1`
+	var args []interface{}
+	if !since.IsZero() {
+		// started_at is stored as text in whatever offset the run started
+		// in, so it can't be compared with since directly. The text
+		// comparison only narrows the rows down, by a bound that holds
+		// for any offset; the exact check is made on the parsed time.
+		query += ` AND started_at >= ?`
+		args = append(args, since.UTC().Add(-utcOffsetSpan).Format("2006-01-02 15:04:05"))
+	}
+	if taskID != 0 {
+		query += ` AND task_id = ?`
+		args = append(args, taskID)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return err
+		}
+		if r.StartedAt.Before(since) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// LastOutcome returns the status of the task's latest run that succeeded or
+// failed, ignoring runs in progress and skips. It is empty if there is none.
+func (s *Store) LastOutcome(taskID int) (string, error) {
+	var status string
+	err := s.db.QueryRow(`SELECT status FROM runs WHERE task_id=? AND status IN (?, ?) ORDER BY id DESC LIMIT 1`, taskID, models.RunStatusSuccess, models.RunStatusFailed).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+// SuccessRate returns the fraction of the task's last lastN finished runs
+// that succeeded, and how many runs that was. Runs in progress and skips are
+// not counted; the rate is 0 when there are no runs.
+func (s *Store) SuccessRate(taskID, lastN int) (rate float64, count int, err error) {
+	var successes int
+	err = s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(status=?), 0) FROM (SELECT status FROM runs WHERE task_id=? AND status IN (?, ?) ORDER BY id DESC LIMIT ?)`,
+		models.RunStatusSuccess, taskID, models.RunStatusSuccess, models.RunStatusFailed, lastN).Scan(&count, &successes)
+	if err != nil || count == 0 {
+		return 0, count, err
+	}
+	return float64(successes) / float64(count), count, nil
+}
+
+// ConsecutiveFailures counts the task's most recent finished runs that failed,
+// stopping at the latest success or ResetTaskFailures.
+func (s *Store) ConsecutiveFailures(taskID int) (int, error) {
+	row := s.db.QueryRow(`SELECT COUNT(*) FROM runs WHERE task_id=? AND status=? AND id > MAX(COALESCE((SELECT MAX(id) FROM runs WHERE task_id=? AND status=?), 0), COALESCE((SELECT failures_reset_run_id FROM tasks WHERE id=?), 0))`,
+		taskID, models.RunStatusFailed, taskID, models.RunStatusSuccess, taskID)
+	var n int
+	err := row.Scan(&n)
+	return n, err
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencron/opencron/internal/models"
+)
+
+func newTestStore(tb testing.TB) *Store {
+	tb.Helper()
+	s, err := New(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatalf("failed to create store: %v", err)
+	}
+	tb.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+func TestGetTasksCacheInvalidatedOnWrite(t *testing.T) {
+	s := newTestStore(t)
+	task := models.Task{Name: "cached", Schedule: "@hourly", Command: "echo hi", Enabled: true}
+	if err := s.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	if _, err := s.GetTasks(); err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	queries := s.taskQueries.Load()
+	tasks, err := s.GetTasks()
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if s.taskQueries.Load() != queries {
+		t.Fatalf("expected a repeated read to be served from the cache")
+	}
+
+	tasks[0].Name = "mutated by caller"
+	task.Name = "renamed"
+	if err := s.UpdateTask(&task); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	tasks, err = s.GetTasks()
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Name != "renamed" {
+		t.Fatalf("expected the write to be visible, got %+v", tasks)
+	}
+}
+
+func TestGetTasksCacheUpdatedByRunBookkeeping(t *testing.T) {
+	s := newTestStore(t)
+	task := models.Task{Name: "busy", Schedule: "@hourly", Command: "echo hi", Enabled: true}
+	if err := s.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if _, err := s.GetTasks(); err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	queries := s.taskQueries.Load()
+
+	now := time.Now().UTC()
+	if err := s.UpdateLastRun(task.ID, now); err != nil {
+		t.Fatalf("UpdateLastRun failed: %v", err)
+	}
+	if err := s.SetLastError(task.ID, "boom"); err != nil {
+		t.Fatalf("SetLastError failed: %v", err)
+	}
+	if err := s.SetScheduleStatus(task.ID, false, "bad spec"); err != nil {
+		t.Fatalf("SetScheduleStatus failed: %v", err)
+	}
+	tasks, err := s.GetTasks()
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if s.taskQueries.Load() != queries {
+		t.Fatalf("expected run bookkeeping to keep the cache")
+	}
+	got := tasks[0]
+	if !got.LastRun.Equal(now) || got.LastError != "boom" || got.LastScheduleOK || got.ScheduleError != "bad spec" {
+		t.Fatalf("expected the cached task to reflect the writes, got %+v", got)
+	}
+}
+
+func TestStartAfterRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	task := models.Task{Name: "later", Schedule: "@hourly", Command: "echo hi"}
+	if err := s.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if _, err := s.db.Exec(`UPDATE tasks SET start_after=NULL WHERE id=?`, task.ID); err != nil {
+		t.Fatalf("failed to clear start_after: %v", err)
+	}
+	got, err := s.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("expected a NULL start_after to load, got: %v", err)
+	}
+	if !got.StartAfter.IsZero() {
+		t.Fatalf("expected zero start_after, got %s", got.StartAfter)
+	}
+
+	startAfter := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	got.StartAfter = startAfter
+	if err := s.UpdateTask(got); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	got, err = s.GetTaskByID(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskByID failed: %v", err)
+	}
+	if !got.StartAfter.Equal(startAfter) {
+		t.Fatalf("expected start_after %s, got %s", startAfter, got.StartAfter)
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	s := newTestStore(t)
+	rate, count, err := s.SuccessRate(1, 3)
+	if err != nil || rate != 0 || count != 0 {
+		t.Fatalf("expected no runs, got rate=%v count=%d err=%v", rate, count, err)
+	}
+
+	// Oldest first: only the last three finished runs count, and the
+	// skipped and running ones are ignored.
+	for _, status := range []string{models.RunStatusFailed, models.RunStatusSuccess, models.RunStatusFailed, models.RunStatusSkipped, models.RunStatusSuccess, models.RunStatusRunning} {
+		run := models.Run{TaskID: 1, Status: status, StartedAt: time.Now()}
+		if err := s.CreateRun(&run); err != nil {
+			t.Fatalf("failed to create run: %v", err)
+		}
+	}
+	rate, count, err = s.SuccessRate(1, 3)
+	if err != nil {
+		t.Fatalf("SuccessRate failed: %v", err)
+	}
+	if count != 3 || rate < 0.66 || rate > 0.67 {
+		t.Fatalf("expected 2 of 3 runs to have succeeded, got rate=%v count=%d", rate, count)
+	}
+}
+
+func TestFindSimilar(t *testing.T) {
+	s := newTestStore(t)
+	var ids []int
+	for _, task := range []models.Task{
+		{Name: "Nightly Backup", Schedule: "0 2 * * *", Command: "backup.sh"},
+		{Name: "other", Schedule: "0 3 * * *", Command: "rsync -a /data /mnt"},
+		{Name: "unrelated", Schedule: "0 3 * * *", Command: "echo hi"},
+	} {
+		if err := s.CreateTask(&task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		ids = append(ids, task.ID)
+	}
+
+	taskIDs := func(tasks []models.Task) []int {
+		out := []int{}
+		for _, task := range tasks {
+			out = append(out, task.ID)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name, command, schedule string
+		exclude                 int
+		want                    []int
+	}{
+		{" nightly backup ", "", "", 0, []int{ids[0]}},
+		{"new", "rsync -a /data /mnt ", "0 3 * * *", 0, []int{ids[1]}},
+		{"Nightly Backup", "rsync -a /data /mnt", "0 3 * * *", 0, []int{ids[0], ids[1]}},
+		// The same command on another schedule is not a duplicate.
+		{"new", "echo hi", "0 4 * * *", 0, []int{}},
+		{"Nightly Backup", "backup.sh", "0 2 * * *", ids[0], []int{}},
+		{"", "", "", 0, []int{}},
+	} {
+		similar, err := s.FindSimilar(tc.name, tc.command, tc.schedule, tc.exclude)
+		if err != nil {
+			t.Fatalf("FindSimilar failed: %v", err)
+		}
+		if got := taskIDs(similar); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("FindSimilar(%q, %q, %q): expected %v, got %v", tc.name, tc.command, tc.schedule, tc.want, got)
+		}
+	}
+}
+
+// BenchmarkGetTasksWriteHeavy mimics a busy server: every edit and every
+// run's bookkeeping writes are followed by an engine Reload and a few API
+// list calls. queries/op is the number of task list reads that reached
+// SQLite.
+func BenchmarkGetTasksWriteHeavy(b *testing.B) {
+	s := newTestStore(b)
+	var tasks []models.Task
+	for i := 0; i < 50; i++ {
+		task := models.Task{Name: "task", Schedule: "@hourly", Command: "echo hi", Enabled: true}
+		if err := s.CreateTask(&task); err != nil {
+			b.Fatalf("failed to create task: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	list := func() {
+		for j := 0; j < 5; j++ {
+			if _, err := s.GetTasks(); err != nil {
+				b.Fatalf("GetTasks failed: %v", err)
+			}
+		}
+	}
+
+	s.taskQueries.Store(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task := tasks[i%len(tasks)]
+		if i%10 == 0 {
+			if err := s.UpdateTask(&task); err != nil {
+				b.Fatalf("UpdateTask failed: %v", err)
+			}
+			list()
+		}
+		if err := s.UpdateLastRun(task.ID, time.Now()); err != nil {
+			b.Fatalf("UpdateLastRun failed: %v", err)
+		}
+		list()
+		if err := s.SetLastError(task.ID, ""); err != nil {
+			b.Fatalf("SetLastError failed: %v", err)
+		}
+		list()
+	}
+	b.ReportMetric(float64(s.taskQueries.Load())/float64(b.N), "queries/op")
+}
+
+func TestStateChangesRecorded(t *testing.T) {
+	s := newTestStore(t)
+	task := models.Task{Name: "tracked", Schedule: "@hourly", Command: "echo hi", Enabled: true, Folder: "ops"}
+	if err := s.CreateTask(&task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	if err := s.SetTaskLocked(task.ID, true, "alice"); err != nil {
+		t.Fatalf("SetTaskLocked failed: %v", err)
+	}
+	if ids, err := s.SetEnabledByFilter(TaskFilter{Folder: "ops"}, false, "bob"); err != nil || len(ids) != 1 {
+		t.Fatalf("SetEnabledByFilter = %v, %v", ids, err)
+	}
+	if err := s.ResetTaskFailures(task.ID, "carol"); err != nil {
+		t.Fatalf("ResetTaskFailures failed: %v", err)
+	}
+	if changed, err := s.AutoDisableTask(task.ID); err != nil || changed {
+		t.Fatalf("expected a disabled task to be left alone, got %v, %v", changed, err)
+	}
+
+	changes, err := s.GetTaskChanges(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskChanges failed: %v", err)
+	}
+	var by []string
+	for _, c := range changes {
+		by = append(by, c.ChangedBy)
+	}
+	// The reset changes nothing but the version and isn't recorded.
+	if fmt.Sprint(by) != "[bob alice]" {
+		t.Fatalf("expected changes by bob and alice, got %v", by)
+	}
+	if _, ok := changes[0].Changes["enabled"]; !ok {
+		t.Fatalf("expected the bulk disable to record enabled, got %+v", changes[0].Changes)
+	}
+
+	if err := s.DeleteTask(task.ID, false); !errors.Is(err, ErrTaskLocked) {
+		t.Fatalf("expected the locked task to be kept, got %v", err)
+	}
+	if err := s.DeleteTask(task.ID, true); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+	if changes, err := s.GetTaskChanges(task.ID); err != nil || len(changes) != 0 {
+		t.Fatalf("expected the history to be deleted with the task, got %v, %v", changes, err)
+	}
+}
+
+func TestEachRunSinceAnyOffset(t *testing.T) {
+	s := newTestStore(t)
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	run := models.Run{TaskID: 1, Status: models.RunStatusSuccess, StartedAt: started.In(time.FixedZone("EST", -5*3600))}
+	if err := s.CreateRun(&run); err != nil {
+		t.Fatalf("failed to create run: %v", err)
+	}
+
+	for _, tc := range []struct {
+		since string
+		want  int
+	}{
+		{"2026-01-01T16:00:00+05:00", 1},
+		{"2026-01-01T08:00:00-05:00", 0},
+		{"2026-01-01T12:00:00Z", 1},
+	} {
+		since, err := time.Parse(time.RFC3339, tc.since)
+		if err != nil {
+			t.Fatalf("bad since %q: %v", tc.since, err)
+		}
+		got := 0
+		if err := s.EachRun(since, 0, func(models.Run) error { got++; return nil }); err != nil {
+			t.Fatalf("EachRun failed: %v", err)
+		}
+		if got != tc.want {
+			t.Fatalf("since %s: expected %d runs, got %d", tc.since, tc.want, got)
+		}
+	}
+}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/opencron/opencron/internal/engine"
 	"github.com/opencron/opencron/internal/handlers"
+	"github.com/opencron/opencron/internal/models"
 	"github.com/opencron/opencron/internal/store"
 )
 
@@ -33,6 +40,16 @@ func main() {
 		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
+	// MIGRATE_ONLY applies schema migrations and exits without starting the
+	// server, e.g. from an init container. A failed migration exits 1 above.
+	if migrateOnly, _ := strconv.ParseBool(os.Getenv("MIGRATE_ONLY")); migrateOnly {
+		if err := s.Close(); err != nil {
+			log.Fatalf("Failed to close store: %v", err)
+		}
+		log.Printf("Migrations applied to %s", dbPath)
+		return
+	}
+
 	retentionHours := 48
 	if val := os.Getenv("LOG_RETENTION_HOURS"); val != "" {
 		if h, err := strconv.Atoi(val); err == nil {
@@ -42,23 +59,245 @@ func main() {
 	retention := time.Duration(retentionHours) * time.Hour
 
 	e := engine.New(s, dataDir, retention)
+	e.Environment = os.Getenv("OPENCRON_ENV")
+	timezone := os.Getenv("DEFAULT_TIMEZONE")
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_TIMEZONE %q: %v", timezone, err)
+		}
+		e.SetLocation(loc)
+		log.Printf("Evaluating schedules in %s", loc)
+	}
+	if bucket := os.Getenv("LOG_ARCHIVE_S3_BUCKET"); bucket != "" {
+		e.LogArchive = &engine.S3Archive{
+			Endpoint:        os.Getenv("LOG_ARCHIVE_S3_ENDPOINT"),
+			Region:          os.Getenv("LOG_ARCHIVE_S3_REGION"),
+			Bucket:          bucket,
+			Prefix:          os.Getenv("LOG_ARCHIVE_S3_PREFIX"),
+			AccessKeyID:     os.Getenv("LOG_ARCHIVE_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("LOG_ARCHIVE_S3_SECRET_ACCESS_KEY"),
+		}
+		if e.LogArchive.Region == "" {
+			e.LogArchive.Region = "us-east-1"
+		}
+	}
+	if val := os.Getenv("FOLDER_DEFAULTS_FILE"); val != "" {
+		defaults, err := engine.LoadFolderDefaults(val)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		e.FolderDefaults = defaults
+	}
+	e.SandboxRuntime = os.Getenv("SANDBOX_RUNTIME")
+	e.SandboxImage = os.Getenv("SANDBOX_IMAGE")
+	if val := os.Getenv("RUN_DEDUP_WINDOW"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			e.RunDedupWindow = d
+		} else {
+			log.Printf("Ignoring invalid RUN_DEDUP_WINDOW %q: %v", val, err)
+		}
+	}
+	for _, host := range strings.Split(os.Getenv("REMOTE_SCRIPT_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			e.RemoteScriptHosts = append(e.RemoteScriptHosts, host)
+		}
+	}
+	e.GlobalEnvFile = os.Getenv("GLOBAL_ENV_FILE")
+	if err := e.LoadGlobalEnv(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if e.GlobalEnvFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := e.LoadGlobalEnv(); err != nil {
+					log.Printf("Keeping the previous global env: %v", err)
+					continue
+				}
+				log.Printf("Reloaded global env from %s", e.GlobalEnvFile)
+			}
+		}()
+	}
+	e.LogRotation = os.Getenv("LOG_ROTATION")
+	if !engine.ValidLogRotation(e.LogRotation) {
+		log.Fatalf("Invalid LOG_ROTATION %q: expected daily, weekly or monthly", e.LogRotation)
+	}
+	e.LogMarkers = os.Getenv("LOG_MARKERS")
+	if e.LogMarkers != "" && e.LogMarkers != models.LogMarkersText && e.LogMarkers != models.LogMarkersJSON {
+		log.Fatalf("Invalid LOG_MARKERS %q: expected text or json", e.LogMarkers)
+	}
+	if val := os.Getenv("DEFAULT_TASK_TIMEOUT"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			e.DefaultTimeout = d
+		} else {
+			log.Printf("Ignoring invalid DEFAULT_TASK_TIMEOUT %q: %v", val, err)
+		}
+	}
+	if val := os.Getenv("COMMAND_WRAPPER"); val != "" {
+		wrapper, err := template.New("COMMAND_WRAPPER").Parse(val)
+		if err != nil {
+			log.Fatalf("Invalid COMMAND_WRAPPER: %v", err)
+		}
+		e.CommandWrapper = wrapper
+		log.Printf("Wrapping all task commands with %q", val)
+	}
 	e.Start()
+	heartbeat, _ := strconv.ParseBool(os.Getenv("ENABLE_HEARTBEAT"))
+	if heartbeat {
+		e.StartHeartbeat()
+	}
+	watchdogInterval := engine.DefaultWatchdogInterval
+	if val := os.Getenv("SCHEDULER_WATCHDOG_INTERVAL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			watchdogInterval = d
+		} else {
+			log.Printf("Ignoring invalid SCHEDULER_WATCHDOG_INTERVAL %q: %v", val, err)
+		}
+	}
+	if watchdogInterval > 0 {
+		e.StartWatchdog(watchdogInterval)
+	}
 
 	api := &handlers.API{
 		Store:   s,
 		Engine:  e,
 		DataDir: dataDir,
 	}
+	if val := os.Getenv("MAX_TASKS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			api.MaxTasks = n
+		}
+	}
+	if val := os.Getenv("MAX_BODY_BYTES"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			api.MaxBodyBytes = n
+		}
+	}
+	if val := os.Getenv("MAX_LARGE_BODY_BYTES"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			api.MaxLargeBodyBytes = n
+		}
+	}
+	if val := os.Getenv("IDEMPOTENCY_KEY_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			api.IdempotencyKeyTTL = d
+		} else {
+			log.Printf("Ignoring invalid IDEMPOTENCY_KEY_TTL %q: %v", val, err)
+		}
+	}
+
+	if val := os.Getenv("TRUSTED_PROXIES"); val != "" {
+		proxies, err := handlers.ParseTrustedProxies(val)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+		}
+		api.TrustedProxies = proxies
+	}
 
-	http.HandleFunc("/", api.ServeHTTP)
+	api.DevMode, _ = strconv.ParseBool(os.Getenv("DEV_MODE"))
+	if api.DevMode {
+		log.Printf("DEV_MODE is on; debugging endpoints that start runs early are enabled. Do not use in production")
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		log.Fatalf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	api.Config = handlers.Config{
+		Port:               port,
+		DataDir:            dataDir,
+		LogRetentionHours:  retentionHours,
+		LogRotation:        e.LogRotation,
+		LogMarkers:         e.LogMarkers,
+		DefaultTaskTimeout: e.DefaultTimeout.String(),
+		CommandWrapper:     os.Getenv("COMMAND_WRAPPER"),
+		Environment:        e.Environment,
+		DefaultTimezone:    timezone,
+		MaxTasks:           api.MaxTasks,
+		HeartbeatEnabled:   heartbeat,
+		APIKeySet:          os.Getenv("API_KEY") != "" || os.Getenv("API_KEYS") != "",
+		TLSEnabled:         certFile != "",
+		DevMode:            api.DevMode,
+		// /mcp is always served alongside the REST API.
+		MCPEnabled: true,
+	}
+
+	http.Handle("/", api.LogRequests(api))
+
+	if certFile != "" {
+		certs, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		certs.reloadOnSIGHUP()
+		srv := &http.Server{Addr: ":" + port, TLSConfig: &tls.Config{GetCertificate: certs.getCertificate}}
+		log.Printf("Opencron starting on :%s (HTTPS)", port)
+		if err := srv.ListenAndServeTLS("", ""); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+		return
+	}
+
 	log.Printf("Opencron starting on :%s", port)
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// certReloader serves the TLS certificate from disk, re-reading it on SIGHUP
+// so a rotated certificate takes effect without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// reloadOnSIGHUP reloads the certificate on every SIGHUP. A certificate that
+// fails to load is logged and the previous one kept.
+func (r *certReloader) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := r.reload(); err != nil {
+				log.Printf("Failed to reload TLS certificate, keeping the current one: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificate from %s", r.certFile)
+		}
+	}()
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -170,7 +170,8 @@ async function runTask(id) {
         setStatus(`Failed to run task ${id} (${res.status}).`);
         return;
     }
-    setStatus(`Task ${id} triggered.`);
+    const { run_id: runId } = await res.json();
+    setStatus(`Task ${id} triggered as run #${runId}.`);
     await loadTasks();
 }
 